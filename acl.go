@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// effects of ACLRule
+const (
+	ACLEffectAllow = "allow"
+	ACLEffectDeny  = "deny"
+)
+
+// RoleAdmin may read the jobs of other users
+const RoleAdmin = "admin"
+
+// ACLResource is the channel, chaincode and function a request operates on
+// empty fields mean the request does not target such a resource
+type ACLResource struct {
+	ChannelID   string
+	ChaincodeID string
+	Function    string
+}
+
+// validateACL 校验角色及acl规则，未声明的角色视为配置错误
+func validateACL(config *RestfulServer) error {
+	declared := make(map[string]bool, len(config.Roles))
+	for _, role := range config.Roles {
+		declared[role] = true
+	}
+
+	for _, user := range config.GinUsers {
+		for _, role := range user.Roles {
+			if !declared[role] {
+				return fmt.Errorf("role %s of user %s is not declared", role, user.User)
+			}
+		}
+	}
+	for _, mapping := range config.TLS.ClientCerts {
+		for _, role := range mapping.Roles {
+			if !declared[role] {
+				return fmt.Errorf("role %s of tls client cert %s is not declared", role, mapping.Subject)
+			}
+		}
+	}
+
+	names := make(map[string]bool, len(config.ACL))
+	for i, rule := range config.ACL {
+		if rule.Name == "" {
+			return fmt.Errorf("acl rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate acl rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Effect != "" && rule.Effect != ACLEffectAllow && rule.Effect != ACLEffectDeny {
+			return fmt.Errorf("acl rule %s has unknown effect %s", rule.Name, rule.Effect)
+		}
+		if len(rule.Roles) == 0 || len(rule.Routes) == 0 {
+			return fmt.Errorf("acl rule %s must have roles and routes", rule.Name)
+		}
+		for _, role := range rule.Roles {
+			if role != "*" && !declared[role] {
+				return fmt.Errorf("role %s of acl rule %s is not declared", role, rule.Name)
+			}
+		}
+
+		patterns := append(append(append([]string{}, rule.Channels...), rule.Chaincodes...), rule.Functions...)
+		for _, route := range rule.Routes {
+			_, pattern := splitRoute(route)
+			patterns = append(patterns, pattern)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("acl rule %s has bad pattern %s: %v", rule.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitRoute 拆分 "METHOD /path" 形式的路由，未指定method时匹配所有method
+func splitRoute(route string) (string, string) {
+	fields := strings.Fields(route)
+	if len(fields) == 2 {
+		return strings.ToUpper(fields[0]), fields[1]
+	}
+	return "", route
+}
+
+// matchPattern "*"匹配任意值，其余使用path.Match的通配规则
+func matchPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource 规则未限定时匹配任意值，限定时请求必须指定且匹配
+func matchResource(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	return value != "" && matchPattern(patterns, value)
+}
+
+func (rule *ACLRule) matchRoute(method, fullPath string) bool {
+	for _, route := range rule.Routes {
+		m, pattern := splitRoute(route)
+		if m != "" && m != method {
+			continue
+		}
+		if matchPattern([]string{pattern}, fullPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *ACLRule) matchRoles(roles []string) bool {
+	for _, role := range roles {
+		if matchPattern(rule.Roles, role) {
+			return true
+		}
+	}
+	// 规则适用于所有用户，包括未分配角色的用户
+	return matchPattern(rule.Roles, "")
+}
+
+func (rule *ACLRule) match(roles []string, method, fullPath string, res *ACLResource) bool {
+	return rule.matchRoles(roles) && rule.matchRoute(method, fullPath) &&
+		matchResource(rule.Channels, res.ChannelID) &&
+		matchResource(rule.Chaincodes, res.ChaincodeID) &&
+		matchResource(rule.Functions, res.Function)
+}
+
+// userRoles 返回rest用户的角色，客户端证书直接映射为fabric身份时使用映射中的角色
+func userRoles(ctx *gin.Context, restUser string) []string {
+	if roles, ok := ctx.Get(ctxKeyRoles); ok {
+		return roles.([]string)
+	}
+	if user := findGinUser(restUser); user != nil {
+		return user.Roles
+	}
+	return nil
+}
+
+// hasRole rest用户是否拥有该角色
+func hasRole(ctx *gin.Context, restUser, role string) bool {
+	for _, r := range userRoles(ctx, restUser) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// checkACL 按顺序匹配acl规则，第一条匹配的规则决定是否允许
+// 返回匹配的规则，未配置acl时不做限制
+func checkACL(restUser string, roles []string, method, fullPath string, res *ACLResource) (*ACLRule, error) {
+	if len(serverConfig.ACL) == 0 {
+		return nil, nil
+	}
+
+	for i := range serverConfig.ACL {
+		rule := &serverConfig.ACL[i]
+		if !rule.match(roles, method, fullPath, res) {
+			continue
+		}
+		if rule.Effect == ACLEffectDeny {
+			return rule, fmt.Errorf("user %s (roles %v) is denied %s %s%s by acl rule %s", restUser, roles, method, fullPath, res, rule.Name)
+		}
+		return rule, nil
+	}
+	return nil, fmt.Errorf("no acl rule allows user %s (roles %v) to call %s %s%s", restUser, roles, method, fullPath, res)
+}
+
+func (res *ACLResource) String() string {
+	var b strings.Builder
+	if res.ChannelID != "" {
+		b.WriteString(" on channel " + res.ChannelID)
+	}
+	if res.ChaincodeID != "" {
+		b.WriteString(" chaincode " + res.ChaincodeID)
+	}
+	if res.Function != "" {
+		b.WriteString(" function " + res.Function)
+	}
+	return b.String()
+}
+
+// authorize 校验当前rest用户是否有权限访问该路由及资源，需在创建sdk context之前调用
+// 拒绝时已写入403响应，调用方需直接返回
+func authorize(ctx *gin.Context, res *ACLResource) bool {
+	restUser := ctx.GetString(gin.AuthUserKey)
+	rule, err := checkACL(restUser, userRoles(ctx, restUser), ctx.Request.Method, ctx.FullPath(), res)
+	if err == nil {
+		return true
+	}
+
+	log.Println("the authorization failed : ", err.Error())
+	response := gin.H{"error": err.Error()}
+	if rule != nil {
+		response["rule"] = rule.Name
+	}
+	ctx.JSON(http.StatusForbidden, response)
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+)
+
+// testACL 与config-server.yaml中的示例规则一致
+var testACL = []ACLRule{
+	{Name: "admin-all", Roles: []string{"admin"}, Routes: []string{"*"}},
+	{Name: "operator-transact", Roles: []string{"operator"}, Routes: []string{"POST /cc/invoke", "POST /cc/batch"}, Channels: []string{"mychannel"}},
+	{Name: "reader-no-history", Effect: ACLEffectDeny, Roles: []string{"reader"}, Routes: []string{"GET /cc/query"}, Functions: []string{"queryHistory*"}},
+	{Name: "read-only", Roles: []string{"operator", "reader"}, Routes: []string{"GET *", "POST /hello", "POST /cc/batch"}},
+}
+
+func TestCheckACL(t *testing.T) {
+	oldConfig := serverConfig
+	defer func() { serverConfig = oldConfig }()
+	serverConfig = &ServerConfig{}
+
+	tests := []struct {
+		acl    []ACLRule
+		roles  []string
+		method string
+		path   string
+		res    ACLResource
+		// rule为空表示没有规则匹配
+		rule    string
+		allowed bool
+	}{
+		// 没有规则时不做限制，即使声明了角色
+		{nil, nil, "POST", "/cc/update", ACLResource{}, "", true},
+		{testACL, []string{"admin"}, "POST", "/cc/update", ACLResource{ChannelID: "other"}, "admin-all", true},
+		{testACL, []string{"operator"}, "POST", "/cc/invoke", ACLResource{ChannelID: "mychannel", ChaincodeID: "fabcar"}, "operator-transact", true},
+		{testACL, []string{"operator"}, "POST", "/cc/invoke", ACLResource{ChannelID: "other", ChaincodeID: "fabcar"}, "", false},
+		// 规则限定了通道时，不指定通道的请求不匹配
+		{testACL, []string{"operator"}, "POST", "/cc/invoke", ACLResource{}, "", false},
+		{testACL, []string{"operator"}, "GET", "/cc/query", ACLResource{ChannelID: "other", Function: "queryHistory"}, "read-only", true},
+		{testACL, []string{"reader"}, "GET", "/cc/query", ACLResource{ChannelID: "mychannel", Function: "queryHistoryForKey"}, "reader-no-history", false},
+		{testACL, []string{"reader"}, "GET", "/cc/query", ACLResource{ChannelID: "mychannel", Function: "queryCar"}, "read-only", true},
+		{testACL, []string{"reader"}, "POST", "/cc/invoke", ACLResource{ChannelID: "mychannel"}, "", false},
+		{testACL, []string{"reader"}, "GET", "/block/:number", ACLResource{}, "read-only", true},
+		{testACL, []string{"reader", "admin"}, "POST", "/cc/update", ACLResource{}, "admin-all", true},
+		{testACL, nil, "GET", "/jobs/:txID", ACLResource{}, "", false},
+		// "*"的角色也匹配未分配角色的用户
+		{[]ACLRule{{Name: "all", Roles: []string{"*"}, Routes: []string{"/hello"}}}, nil, "POST", "/hello", ACLResource{}, "all", true},
+		{[]ACLRule{{Name: "all", Roles: []string{"*"}, Routes: []string{"/hello"}}}, nil, "POST", "/helloworld", ACLResource{}, "", false},
+		{[]ACLRule{{Name: "events", Roles: []string{"*"}, Routes: []string{"GET /events/*"}}}, nil, "GET", "/events/blocks", ACLResource{}, "events", true},
+	}
+
+	for i, test := range tests {
+		serverConfig.ACL = test.acl
+		rule, err := checkACL("user", test.roles, test.method, test.path, &test.res)
+		if (err == nil) != test.allowed {
+			t.Errorf("case %d %s %s: expected allowed %v, got %v", i, test.method, test.path, test.allowed, err)
+		}
+		name := ""
+		if rule != nil {
+			name = rule.Name
+		}
+		if name != test.rule {
+			t.Errorf("case %d %s %s: expected rule %q, got %q", i, test.method, test.path, test.rule, name)
+		}
+	}
+}
+
+func TestValidateACL(t *testing.T) {
+	roles := []string{"admin", "operator", "reader"}
+	tests := []struct {
+		config RestfulServer
+		ok     bool
+	}{
+		{RestfulServer{}, true},
+		{RestfulServer{Roles: roles, ACL: testACL}, true},
+		{RestfulServer{Roles: roles, GinUsers: []GinUser{{User: "user1", Roles: []string{"root"}}}}, false},
+		{RestfulServer{Roles: []string{"admin"}, ACL: testACL}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Roles: roles, Routes: []string{"*"}}}}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Name: "a", Roles: roles, Routes: []string{"*"}}, {Name: "a", Roles: roles, Routes: []string{"*"}}}}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Name: "a", Effect: "block", Roles: roles, Routes: []string{"*"}}}}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Name: "a", Roles: roles}}}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Name: "a", Roles: roles, Routes: []string{"GET /cc/["}}}}, false},
+		{RestfulServer{Roles: roles, ACL: []ACLRule{{Name: "a", Roles: roles, Routes: []string{"*"}, Channels: []string{"my[channel"}}}}, false},
+	}
+
+	for i, test := range tests {
+		err := validateACL(&test.config)
+		if (err == nil) != test.ok {
+			t.Errorf("case %d: expected ok %v, got %v", i, test.ok, err)
+		}
+	}
+}
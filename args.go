@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+)
+
+// formats of the chaincode response payload
+const (
+	ResponseFormatRaw    = "raw"
+	ResponseFormatBase64 = "base64"
+	ResponseFormatJSON   = "json"
+)
+
+// Arg is a chaincode argument or transient value
+// it is either a plain string sent as UTF-8, or {"encoding": "utf8|base64|json", "data": ...}
+// data of the json encoding is any JSON value, sent in its compact form
+type Arg []byte
+
+// UnmarshalJSON 按encoding解码参数
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*a = Arg(s)
+		return nil
+	}
+
+	var encoded struct {
+		Encoding string          `json:"encoding"`
+		Data     json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil || len(encoded.Data) == 0 {
+		return errors.New(`arg must be a string or {"encoding": "utf8|base64|json", "data": ...}`)
+	}
+
+	switch encoded.Encoding {
+	case ValueEncodingUTF8, ValueEncodingBase64:
+		var s string
+		if err := json.Unmarshal(encoded.Data, &s); err != nil {
+			return fmt.Errorf("data of %s arg must be a string", encoded.Encoding)
+		}
+		if encoded.Encoding == ValueEncodingUTF8 {
+			*a = Arg(s)
+			return nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("invalid base64 arg: %v", err)
+		}
+		*a = decoded
+	case ValueEncodingJSON:
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, encoded.Data); err != nil {
+			return err
+		}
+		*a = compacted.Bytes()
+	default:
+		return fmt.Errorf("unknown arg encoding %s, must be utf8, base64 or json", encoded.Encoding)
+	}
+	return nil
+}
+
+// MarshalJSON 用于打印请求日志，按内容渲染
+func (a Arg) MarshalJSON() ([]byte, error) {
+	return json.Marshal(renderValue(a))
+}
+
+// TransientMap is the private input passed to the chaincode, it is never written to the ledger
+type TransientMap map[string]Arg
+
+// MarshalJSON 用于打印请求日志，隐藏私有数据只保留key
+func (m TransientMap) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return json.Marshal(keys)
+}
+
+// validResponseFormat 未指定时为raw
+func validResponseFormat(format string) error {
+	switch format {
+	case "", ResponseFormatRaw, ResponseFormatBase64, ResponseFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown responseFormat %s, must be raw, base64 or json", format)
+}
+
+// newChannelRequest 根据请求参数构建链码调用请求
+func newChannelRequest(request *Parameters) channel.Request {
+	args := make([][]byte, 0, len(request.Args))
+	for _, arg := range request.Args {
+		args = append(args, arg)
+	}
+	req := channel.Request{
+		ChaincodeID: request.ChaincodeID,
+		Fcn:         request.Function,
+		Args:        args,
+	}
+	if len(request.Transient) > 0 {
+		req.TransientMap = make(map[string][]byte, len(request.Transient))
+		for key, value := range request.Transient {
+			req.TransientMap[key] = value
+		}
+	}
+	return req
+}
+
+// formatPayload 按responseFormat转换链码返回的payload，json格式时payload必须为合法JSON
+func formatPayload(payload []byte, format string) (interface{}, error) {
+	switch format {
+	case ResponseFormatBase64:
+		return base64.StdEncoding.EncodeToString(payload), nil
+	case ResponseFormatJSON:
+		if len(payload) == 0 {
+			return nil, nil
+		}
+		if !json.Valid(payload) {
+			return nil, errors.New("response payload is not valid json")
+		}
+		return json.RawMessage(payload), nil
+	default:
+		return string(payload), nil
+	}
+}
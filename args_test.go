@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestArgUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		arg  string
+		ok   bool
+	}{
+		{`"car1"`, "car1", true},
+		{`""`, "", true},
+		{` "with space" `, "with space", true},
+		{`{"encoding":"utf8","data":"car1"}`, "car1", true},
+		{`{"encoding":"base64","data":"AAEC/w=="}`, "\x00\x01\x02\xff", true},
+		{`{"encoding":"json","data":{"make": "Toyota", "owner": ["Tom"]}}`, `{"make":"Toyota","owner":["Tom"]}`, true},
+		{`{"encoding":"json","data":42}`, "42", true},
+		{`{"encoding":"json","data":"car1"}`, `"car1"`, true},
+		{`{"encoding":"base64","data":"not base64!"}`, "", false},
+		{`{"encoding":"utf8","data":1}`, "", false},
+		{`{"encoding":"hex","data":"00"}`, "", false},
+		{`{"encoding":"utf8"}`, "", false},
+		{`{"data":"car1"}`, "", false},
+		{`42`, "", false},
+		{`["car1"]`, "", false},
+		{`null`, "", false},
+	}
+
+	for _, test := range tests {
+		var arg Arg
+		err := json.Unmarshal([]byte(test.json), &arg)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.json, test.ok, err)
+			continue
+		}
+		if test.ok && string(arg) != test.arg {
+			t.Errorf("%s: expected %q, got %q", test.json, test.arg, arg)
+		}
+	}
+
+	// 在请求中与普通字符串混用
+	var params Parameters
+	body := `{"args":["car1",{"encoding":"base64","data":"/w=="}],"transient":{"price":{"encoding":"json","data":{"amount": 10}}}}`
+	if err := json.Unmarshal([]byte(body), &params); err != nil {
+		t.Fatal(err)
+	}
+	req := newChannelRequest(&params)
+	if len(req.Args) != 2 || string(req.Args[0]) != "car1" || string(req.Args[1]) != "\xff" || string(req.TransientMap["price"]) != `{"amount":10}` {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+func TestArgMarshalJSON(t *testing.T) {
+	tests := []struct {
+		arg  Arg
+		json string
+	}{
+		{Arg("car1"), `{"encoding":"utf8","data":"car1"}`},
+		{Arg(`{"make":"Toyota"}`), `{"encoding":"json","data":{"make":"Toyota"}}`},
+		{Arg{0x00, 0xff}, `{"encoding":"base64","data":"AP8="}`},
+		{nil, `{"encoding":"utf8","data":""}`},
+	}
+	for _, test := range tests {
+		buf, err := json.Marshal(test.arg)
+		if err != nil || string(buf) != test.json {
+			t.Errorf("%q: expected %s, got %s %v", test.arg, test.json, buf, err)
+		}
+	}
+
+	// 隐藏transient的值只保留排序后的key
+	buf, err := json.Marshal(TransientMap{"price": Arg("10"), "buyer": Arg("secret")})
+	if err != nil || string(buf) != `["buyer","price"]` {
+		t.Errorf("expected only the transient keys, got %s %v", buf, err)
+	}
+}
+
+func TestFormatPayload(t *testing.T) {
+	tests := []struct {
+		payload string
+		format  string
+		json    string
+		ok      bool
+	}{
+		{`{"make":"Toyota"}`, "", `"{\"make\":\"Toyota\"}"`, true},
+		{`{"make":"Toyota"}`, ResponseFormatRaw, `"{\"make\":\"Toyota\"}"`, true},
+		{"\x00\xff", ResponseFormatBase64, `"AP8="`, true},
+		{`{"make":"Toyota"}`, ResponseFormatJSON, `{"make":"Toyota"}`, true},
+		{`[1,2]`, ResponseFormatJSON, `[1,2]`, true},
+		{"", ResponseFormatJSON, `null`, true},
+		{"car1", ResponseFormatJSON, "", false},
+	}
+
+	for _, test := range tests {
+		formatted, err := formatPayload([]byte(test.payload), test.format)
+		if (err == nil) != test.ok {
+			t.Errorf("%q %s: expected ok %v, got %v", test.payload, test.format, test.ok, err)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		buf, err := json.Marshal(formatted)
+		if err != nil || string(buf) != test.json {
+			t.Errorf("%q %s: expected %s, got %s %v", test.payload, test.format, test.json, buf, err)
+		}
+	}
+
+	for _, format := range []string{"", ResponseFormatRaw, ResponseFormatBase64, ResponseFormatJSON} {
+		if err := validResponseFormat(format); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+	if err := validResponseFormat("hex"); err == nil {
+		t.Error("expected an unknown responseFormat to be rejected")
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authentication methods of AuthConfig.Methods
+const (
+	AuthMethodBasic  = "basic"
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "apikey"
+	AuthMethodCert   = "cert"
+)
+
+// HeaderAPIKey is the header carrying the static api key
+const HeaderAPIKey = "X-API-Key"
+
+// errNoCredentials 请求中没有该认证方式的凭证，交由下一个认证方式处理
+var errNoCredentials = errors.New("no credentials")
+
+// Authenticator authenticates a request and returns the rest user
+// it returns errNoCredentials if the request carries no credentials of its kind
+type Authenticator interface {
+	Authenticate(ctx *gin.Context) (string, error)
+}
+
+// newAuthenticators 根据配置创建认证方式，未配置时只使用basic认证
+func newAuthenticators(config *AuthConfig) ([]Authenticator, error) {
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = []string{AuthMethodBasic}
+	}
+
+	auths := make([]Authenticator, 0, len(methods))
+	for _, method := range methods {
+		switch method {
+		case AuthMethodBasic:
+			auth, err := newBasicAuthenticator(serverConfig.GinUsers)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, auth)
+		case AuthMethodJWT:
+			auth, err := newJWTAuthenticator(&config.JWT)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, auth)
+		case AuthMethodAPIKey:
+			auth, err := newAPIKeyAuthenticator(config.APIKeys)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, auth)
+		case AuthMethodCert:
+			auth, err := newCertAuthenticator(&serverConfig.TLS)
+			if err != nil {
+				return nil, err
+			}
+			auths = append(auths, auth)
+		default:
+			return nil, fmt.Errorf("unknown auth method %s", method)
+		}
+	}
+	return auths, nil
+}
+
+// authMiddleware 依次尝试各认证方式，认证通过后将用户名写入gin.AuthUserKey
+func authMiddleware(auths []Authenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, auth := range auths {
+			user, err := auth.Authenticate(ctx)
+			if err == errNoCredentials {
+				continue
+			}
+			if err != nil {
+				log.Println("authentication failed: ", err.Error())
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.Set(gin.AuthUserKey, user)
+			ctx.Next()
+			return
+		}
+
+		// 与gin.BasicAuth保持一致，提示客户端使用basic认证
+		for _, auth := range auths {
+			if _, ok := auth.(*basicAuthenticator); ok {
+				ctx.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+				break
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+	}
+}
+
+// basicAuthenticator 使用bcrypt哈希后的密码进行basic认证
+type basicAuthenticator struct {
+	hashes map[string][]byte
+}
+
+func newBasicAuthenticator(users []GinUser) (*basicAuthenticator, error) {
+	hashes := make(map[string][]byte, len(users))
+	for _, user := range users {
+		if user.Passwd == "" {
+			continue
+		}
+		// 拒绝明文密码
+		if _, err := bcrypt.Cost([]byte(user.Passwd)); err != nil {
+			return nil, fmt.Errorf("passwd of user %s is not a bcrypt hash: %v", user.User, err)
+		}
+		hashes[user.User] = []byte(user.Passwd)
+	}
+	return &basicAuthenticator{hashes: hashes}, nil
+}
+
+func (a *basicAuthenticator) Authenticate(ctx *gin.Context) (string, error) {
+	user, passwd, ok := ctx.Request.BasicAuth()
+	if !ok {
+		return "", errNoCredentials
+	}
+	if err := a.verify(user, passwd); err != nil {
+		return "", err
+	}
+	return user, nil
+}
+
+func (a *basicAuthenticator) verify(user, passwd string) error {
+	hash, ok := a.hashes[user]
+	if !ok {
+		return errors.New("invalid user or passwd")
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(passwd)); err != nil {
+		return errors.New("invalid user or passwd")
+	}
+	return nil
+}
+
+// jwtAuthenticator 校验Authorization: Bearer中的JWT，并可签发token
+type jwtAuthenticator struct {
+	config     *JWTConfig
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	expiration time.Duration
+}
+
+func newJWTAuthenticator(config *JWTConfig) (*jwtAuthenticator, error) {
+	auth := &jwtAuthenticator{config: config, expiration: time.Hour}
+	if config.Expiration != "" {
+		expiration, err := time.ParseDuration(config.Expiration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt expiration: %v", err)
+		}
+		auth.expiration = expiration
+	}
+
+	switch config.Algorithm {
+	case "", "HS256":
+		secret, err := readJWTSecret(config)
+		if err != nil {
+			return nil, err
+		}
+		auth.method = jwt.SigningMethodHS256
+		auth.signKey = secret
+		auth.verifyKey = secret
+	case "RS256":
+		auth.method = jwt.SigningMethodRS256
+		publicKey, err := readRSAPublicKey(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		auth.verifyKey = publicKey
+		// 未配置私钥时只校验token，不提供/auth/token
+		if config.PrivateKey != "" {
+			privateKey, err := readRSAPrivateKey(config.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			auth.signKey = privateKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %s", config.Algorithm)
+	}
+	return auth, nil
+}
+
+// minJWTSecretLength HS256的密钥不短于哈希输出长度
+const minJWTSecretLength = 32
+
+// placeholderJWTSecrets 示例配置中常见的占位密钥
+var placeholderJWTSecrets = []string{"change-me", "changeme", "change_me", "replace-me", "replaceme", "secret", "example"}
+
+// readJWTSecret 依次从secretFile、secretEnv、secret读取HS256密钥，拒绝空的、占位的及过短的密钥
+func readJWTSecret(config *JWTConfig) ([]byte, error) {
+	secret := config.Secret
+	switch {
+	case config.SecretFile != "":
+		buf, err := ioutil.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("read jwt secret file failed: %v", err)
+		}
+		secret = strings.TrimSpace(string(buf))
+	case config.SecretEnv != "":
+		secret = os.Getenv(config.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("jwt secret env %s is not set", config.SecretEnv)
+		}
+	}
+
+	if secret == "" {
+		return nil, errors.New("jwt secret is required for HS256, set secretFile or secretEnv")
+	}
+	lower := strings.ToLower(secret)
+	for _, placeholder := range placeholderJWTSecrets {
+		if strings.Contains(lower, placeholder) {
+			return nil, fmt.Errorf("jwt secret looks like a placeholder (contains %q), generate one with e.g. openssl rand -hex 32", placeholder)
+		}
+	}
+	if len(secret) < minJWTSecretLength {
+		return nil, fmt.Errorf("jwt secret must be at least %d bytes, got %d", minJWTSecretLength, len(secret))
+	}
+	return []byte(secret), nil
+}
+
+func readRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt public key failed: %v", err)
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(buf)
+}
+
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt private key failed: %v", err)
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(buf)
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx *gin.Context) (string, error) {
+	header := ctx.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errNoCredentials
+	}
+
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(header, "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+		// 只接受配置的算法，防止算法混淆
+		if token.Method.Alg() != a.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return a.verifyKey, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %v", err)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return "", errors.New("invalid token: exp is required")
+	}
+	if a.config.Issuer != "" && !claims.VerifyIssuer(a.config.Issuer, true) {
+		return "", errors.New("invalid token: unexpected issuer")
+	}
+	if a.config.Audience != "" && !claims.VerifyAudience(a.config.Audience, true) {
+		return "", errors.New("invalid token: unexpected audience")
+	}
+	if claims.Subject == "" {
+		return "", errors.New("invalid token: sub is required")
+	}
+	// 只接受配置中的rest用户，其角色及可用身份由ginuser决定
+	if findGinUser(claims.Subject) == nil {
+		return "", fmt.Errorf("invalid token: unknown user %s", claims.Subject)
+	}
+	return claims.Subject, nil
+}
+
+// issue 为用户签发token
+func (a *jwtAuthenticator) issue(user string) (string, time.Time, error) {
+	if a.signKey == nil {
+		return "", time.Time{}, errors.New("jwt private key is not configured")
+	}
+	now := time.Now()
+	expiresAt := now.Add(a.expiration)
+	claims := &jwt.StandardClaims{
+		Subject:   user,
+		Issuer:    a.config.Issuer,
+		Audience:  a.config.Audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+	token, err := jwt.NewWithClaims(a.method, claims).SignedString(a.signKey)
+	return token, expiresAt, err
+}
+
+// apiKeyAuthenticator 校验X-API-Key，配置中保存key的sha256
+type apiKeyAuthenticator struct {
+	keys []APIKey
+}
+
+func newAPIKeyAuthenticator(keys []APIKey) (*apiKeyAuthenticator, error) {
+	for _, key := range keys {
+		if _, err := hex.DecodeString(key.KeyHash); err != nil || len(key.KeyHash) != sha256.Size*2 {
+			return nil, fmt.Errorf("keyHash of user %s is not a sha256 hex", key.User)
+		}
+	}
+	return &apiKeyAuthenticator{keys: keys}, nil
+}
+
+func (a *apiKeyAuthenticator) Authenticate(ctx *gin.Context) (string, error) {
+	key := ctx.GetHeader(HeaderAPIKey)
+	if key == "" {
+		return "", errNoCredentials
+	}
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(k.KeyHash)), []byte(hash)) == 1 {
+			return k.User, nil
+		}
+	}
+	return "", errors.New("invalid api key")
+}
+
+// issueToken 处理 /auth/token，校验用户名密码后签发JWT
+func issueToken(basic *basicAuthenticator, issuer *jwtAuthenticator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := new(GinUser)
+		if err := ctx.ShouldBindJSON(req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := basic.verify(req.User, req.Passwd); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, expiresAt, err := issuer.issue(req.User)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "token": token, "expiresAt": expiresAt})
+	}
+}
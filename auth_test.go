@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+func TestReadJWTSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "jwt.secret")
+	if err := ioutil.WriteFile(secretFile, []byte(testJWTSecret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TEST_JWT_SECRET", testJWTSecret)
+	defer os.Unsetenv("TEST_JWT_SECRET")
+
+	tests := []struct {
+		config JWTConfig
+		ok     bool
+	}{
+		{JWTConfig{}, false},
+		{JWTConfig{Secret: "change-me"}, false},
+		{JWTConfig{Secret: "change-me-to-a-long-random-string-please"}, false},
+		{JWTConfig{Secret: "0123456789abcdef"}, false},
+		{JWTConfig{Secret: testJWTSecret}, true},
+		{JWTConfig{SecretEnv: "TEST_JWT_SECRET"}, true},
+		{JWTConfig{SecretEnv: "TEST_JWT_SECRET_MISSING"}, false},
+		{JWTConfig{SecretFile: secretFile, Secret: "change-me"}, true},
+		{JWTConfig{SecretFile: filepath.Join(dir, "missing")}, false},
+	}
+
+	for _, test := range tests {
+		secret, err := readJWTSecret(&test.config)
+		if (err == nil) != test.ok {
+			t.Errorf("%+v: expected ok %v, got %v", test.config, test.ok, err)
+			continue
+		}
+		if test.ok && string(secret) != testJWTSecret {
+			t.Errorf("%+v: unexpected secret %q", test.config, secret)
+		}
+	}
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	oldConfig := serverConfig
+	defer func() { serverConfig = oldConfig }()
+	serverConfig = &ServerConfig{}
+	serverConfig.GinUsers = []GinUser{{User: "user1"}}
+
+	auth, err := newJWTAuthenticator(&JWTConfig{Secret: testJWTSecret, Issuer: "restfulserver"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, _, err := auth.issue("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims *jwt.StandardClaims, key string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	tests := []struct {
+		token string
+		user  string
+	}{
+		{issued, "user1"},
+		{sign(&jwt.StandardClaims{Subject: "user1", Issuer: "restfulserver", ExpiresAt: exp}, testJWTSecret), "user1"},
+		// 签名正确但用户未配置
+		{sign(&jwt.StandardClaims{Subject: "root", Issuer: "restfulserver", ExpiresAt: exp}, testJWTSecret), ""},
+		{sign(&jwt.StandardClaims{Subject: "user1", Issuer: "restfulserver", ExpiresAt: exp}, "change-me"), ""},
+		{sign(&jwt.StandardClaims{Subject: "user1", Issuer: "other", ExpiresAt: exp}, testJWTSecret), ""},
+		{sign(&jwt.StandardClaims{Subject: "user1", Issuer: "restfulserver"}, testJWTSecret), ""},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for i, test := range tests {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx.Request.Header.Set("Authorization", "Bearer "+test.token)
+		user, err := auth.Authenticate(ctx)
+		if test.user == "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid token") {
+				t.Errorf("token %d: expected invalid token, got user %q err %v", i, user, err)
+			}
+			continue
+		}
+		if err != nil || user != test.user {
+			t.Errorf("token %d: expected user %s, got %q err %v", i, test.user, user, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// types of BatchOperation
+const (
+	BatchOperationInvoke = "invoke"
+	BatchOperationQuery  = "query"
+)
+
+// status of BatchResult
+const (
+	BatchStatusOK      = "ok"
+	BatchStatusFailed  = "failed"
+	BatchStatusSkipped = "skipped"
+)
+
+// BatchResult is the result of one operation, in the same position as the operation in the request
+// TxId and Valid are set for invokes, Status is the chaincode response status
+type BatchResult struct {
+	Index    int         `json:"index"`
+	Type     string      `json:"type"`
+	Result   string      `json:"result"`
+	Status   int32       `json:"status,omitempty"`
+	TxId     string      `json:"TxId,omitempty"`
+	Valid    string      `json:"Valid,omitempty"`
+	Response interface{} `json:"response,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// batchRoutes 每个操作需同时被允许调用批量接口及对应的单个接口，批量接口不能绕过对单个接口的限制
+var batchRoutes = map[string][2]string{
+	BatchOperationInvoke: {http.MethodPost, "/cc/invoke"},
+	BatchOperationQuery:  {http.MethodGet, "/cc/query"},
+}
+
+// batchOperation 校验通过、待执行的操作
+type batchOperation struct {
+	*BatchOperation
+	client *channel.Client
+}
+
+// prepareBatch 校验所有操作的acl及身份并创建channel客户端，任一操作不合法时整批拒绝，不执行任何操作
+// 失败时已写入响应
+func prepareBatch(ctx *gin.Context, req *BatchRequest) ([]*batchOperation, bool) {
+	restUser := ctx.GetString(gin.AuthUserKey)
+	roles := userRoles(ctx, restUser)
+	clients := make(map[string]*channel.Client)
+
+	ops := make([]*batchOperation, 0, len(req.Operations))
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		route, ok := batchRoutes[op.Type]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d has unknown type %s, must be invoke or query", i, op.Type), "index": i})
+			return nil, false
+		}
+		if op.ChannelID == "" || op.ChaincodeID == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d must have channelID and chaincodeID", i), "index": i})
+			return nil, false
+		}
+		if err := validResponseFormat(op.ResponseFormat); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operation %d: %v", i, err), "index": i})
+			return nil, false
+		}
+
+		res := &ACLResource{ChannelID: op.ChannelID, ChaincodeID: op.ChaincodeID, Function: op.Function}
+		rule, err := checkACL(restUser, roles, ctx.Request.Method, ctx.FullPath(), res)
+		if err == nil {
+			rule, err = checkACL(restUser, roles, route[0], route[1], res)
+		}
+		if err != nil {
+			log.Println("the authorization failed : ", err.Error())
+			response := gin.H{"error": fmt.Sprintf("operation %d: %v", i, err), "index": i}
+			if rule != nil {
+				response["rule"] = rule.Name
+			}
+			ctx.JSON(http.StatusForbidden, response)
+			return nil, false
+		}
+
+		identity, err := resolveIdentity(ctx, op.OrgName, op.UserName)
+		if err != nil {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("operation %d: %v", i, err), "index": i})
+			return nil, false
+		}
+
+		// 相同通道及身份的操作共用一个客户端
+		key := op.ChannelID + "/" + identity.OrgName + "/" + identity.UserName
+		client, ok := clients[key]
+		if !ok {
+			channelContext := sdk.ChannelContext(op.ChannelID, fabsdk.WithUser(identity.UserName), fabsdk.WithOrg(identity.OrgName))
+			if client, err = channel.New(channelContext); err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("operation %d: %v", i, err), "index": i})
+				return nil, false
+			}
+			clients[key] = client
+		}
+		ops = append(ops, &batchOperation{BatchOperation: op, client: client})
+	}
+	return ops, true
+}
+
+// execute 执行单个操作
+func (op *batchOperation) execute(result *BatchResult) {
+	req := newChannelRequest(&op.Parameters)
+
+	var response *channel.Response
+	var err error
+	if op.Type == BatchOperationInvoke {
+		response, err = InvokeCC(op.client, req)
+	} else {
+		response, err = QueryCC(op.client, req)
+	}
+	if err != nil {
+		log.Println("the batch operation err info is : ", result.Index, "====", err.Error())
+		result.Result = BatchStatusFailed
+		result.Error = err.Error()
+		return
+	}
+
+	result.Result = BatchStatusOK
+	result.Status = response.Responses[0].Response.Status
+	if op.Type == BatchOperationInvoke {
+		result.TxId = string(response.TransactionID)
+		result.Valid = response.TxValidationCode.String()
+	}
+	if result.Response, err = formatPayload(response.Responses[0].Response.Payload, op.ResponseFormat); err != nil {
+		result.Result = BatchStatusFailed
+		result.Error = err.Error()
+	}
+}
+
+// runBatch 以concurrency的并发依次开始执行results对应的操作，未开始的操作保持skipped
+// stopOnError时某个操作失败后不再开始新的操作，ctx结束(如客户端断开)后同样不再开始，已开始的操作仍会完成
+func runBatch(ctx context.Context, results []*BatchResult, concurrency int, stopOnError bool, execute func(*BatchResult)) {
+	var mutex sync.Mutex
+	stopped := false
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, result := range results {
+		// 等待空闲的并发期间ctx结束时不再等待
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		mutex.Lock()
+		stop := stopped || ctx.Err() != nil
+		mutex.Unlock()
+		if stop {
+			break
+		}
+
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			execute(result)
+			if result.Result == BatchStatusFailed && stopOnError {
+				mutex.Lock()
+				stopped = true
+				mutex.Unlock()
+			}
+		}(result)
+	}
+	wg.Wait()
+}
+
+// batchCC 处理 POST /cc/batch，以有限的并发执行多个invoke/query，结果与请求中的操作顺序一致
+// stopOnError时某个操作失败后不再开始新的操作，客户端断开后同样不再开始，已开始的操作仍会完成
+func batchCC(ctx *gin.Context) {
+	req := new(BatchRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxOperations := serverConfig.Batch.MaxOperations
+	if maxOperations <= 0 {
+		maxOperations = 1000
+	}
+	maxConcurrency := serverConfig.Batch.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = 16
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxOperations {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch must have 1 to %d operations", maxOperations)})
+		return
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	}
+	if req.Concurrency > maxConcurrency {
+		req.Concurrency = maxConcurrency
+	}
+
+	ops, ok := prepareBatch(ctx, req)
+	if !ok {
+		return
+	}
+	log.Println("the received batch is : ", len(ops), "operations, concurrency", req.Concurrency, ", stopOnError", req.StopOnError)
+
+	results := make([]*BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = &BatchResult{Index: i, Type: op.Type, Result: BatchStatusSkipped}
+	}
+
+	runBatch(ctx.Request.Context(), results, req.Concurrency, req.StopOnError, func(result *BatchResult) {
+		ops[result.Index].execute(result)
+	})
+
+	counts := map[string]int{BatchStatusOK: 0, BatchStatusFailed: 0, BatchStatusSkipped: 0}
+	for _, result := range results {
+		counts[result.Result]++
+	}
+	log.Println("the batch result is : ", counts)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": results, "counts": counts})
+}
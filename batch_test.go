@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeExecutor 记录执行顺序及最大并发，failed中的操作执行失败
+type fakeExecutor struct {
+	mutex    sync.Mutex
+	order    []int
+	running  int32
+	maxSeen  int32
+	failed   map[int]bool
+	delay    time.Duration
+	onFinish func(int)
+}
+
+func (e *fakeExecutor) execute(result *BatchResult) {
+	running := atomic.AddInt32(&e.running, 1)
+	for {
+		max := atomic.LoadInt32(&e.maxSeen)
+		if running <= max || atomic.CompareAndSwapInt32(&e.maxSeen, max, running) {
+			break
+		}
+	}
+	e.mutex.Lock()
+	e.order = append(e.order, result.Index)
+	e.mutex.Unlock()
+
+	time.Sleep(e.delay)
+	if e.failed[result.Index] {
+		result.Result = BatchStatusFailed
+		result.Error = "endorsement failed"
+	} else {
+		result.Result = BatchStatusOK
+		result.Response = result.Index
+	}
+	atomic.AddInt32(&e.running, -1)
+	if e.onFinish != nil {
+		e.onFinish(result.Index)
+	}
+}
+
+func newBatchResults(n int) []*BatchResult {
+	results := make([]*BatchResult, n)
+	for i := range results {
+		results[i] = &BatchResult{Index: i, Type: BatchOperationQuery, Result: BatchStatusSkipped}
+	}
+	return results
+}
+
+// batchStatuses 返回各操作的结果，ok的操作返回自身的序号
+func batchStatuses(results []*BatchResult) string {
+	statuses := make([]string, len(results))
+	for i, result := range results {
+		statuses[i] = result.Result
+		if result.Result == BatchStatusOK && result.Response != i {
+			statuses[i] = fmt.Sprintf("response of %v", result.Response)
+		}
+	}
+	return fmt.Sprint(statuses)
+}
+
+func TestRunBatchConcurrency(t *testing.T) {
+	for _, concurrency := range []int{1, 3, 16} {
+		executor := &fakeExecutor{delay: 5 * time.Millisecond}
+		results := newBatchResults(12)
+		runBatch(context.Background(), results, concurrency, false, executor.execute)
+
+		if int(executor.maxSeen) > concurrency || (concurrency > 1 && executor.maxSeen < 2) {
+			t.Errorf("concurrency %d: %d operations ran at the same time", concurrency, executor.maxSeen)
+		}
+		if len(executor.order) != len(results) {
+			t.Errorf("concurrency %d: expected %d operations executed, got %v", concurrency, len(results), executor.order)
+		}
+		// 结果与请求中的操作顺序一致
+		for i, result := range results {
+			if result.Index != i || result.Result != BatchStatusOK || result.Response != i {
+				t.Errorf("concurrency %d: unexpected result %d %+v", concurrency, i, result)
+			}
+		}
+		// 并发为1时按顺序执行
+		if concurrency == 1 && fmt.Sprint(executor.order) != fmt.Sprint([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+			t.Errorf("expected the operations in order, got %v", executor.order)
+		}
+	}
+}
+
+func TestRunBatchStop(t *testing.T) {
+	ok, failed, skipped := BatchStatusOK, BatchStatusFailed, BatchStatusSkipped
+	tests := []struct {
+		name        string
+		stopOnError bool
+		failed      map[int]bool
+		cancelAfter int
+		expected    []string
+	}{
+		{"all ok", true, nil, -1, []string{ok, ok, ok, ok, ok}},
+		{"stop on error", true, map[int]bool{2: true}, -1, []string{ok, ok, failed, skipped, skipped}},
+		{"continue on error", false, map[int]bool{2: true}, -1, []string{ok, ok, failed, ok, ok}},
+		// 客户端断开后不再开始新的操作
+		{"cancelled", false, nil, 1, []string{ok, ok, skipped, skipped, skipped}},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		executor := &fakeExecutor{failed: test.failed}
+		executor.onFinish = func(index int) {
+			if index == test.cancelAfter {
+				cancel()
+			}
+		}
+		results := newBatchResults(len(test.expected))
+		runBatch(ctx, results, 1, test.stopOnError, executor.execute)
+		cancel()
+		if statuses := batchStatuses(results); statuses != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %s", test.name, test.expected, statuses)
+		}
+	}
+
+	// 请求开始前客户端已断开
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	executor := &fakeExecutor{}
+	results := newBatchResults(3)
+	runBatch(ctx, results, 2, false, executor.execute)
+	if len(executor.order) != 0 || batchStatuses(results) != fmt.Sprint([]string{skipped, skipped, skipped}) {
+		t.Errorf("expected every operation skipped, got %v %s", executor.order, batchStatuses(results))
+	}
+}
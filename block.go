@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// BlockSignature is a signature of the orderer on the block
+type BlockSignature struct {
+	MSP       string `json:"msp"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+}
+
+// BlockMetadata is the decoded metadata of a block
+type BlockMetadata struct {
+	Signatures        []*BlockSignature `json:"signatures"`
+	LastConfigIndex   uint64            `json:"last_config_index"`
+	TxValidationFlags []string          `json:"tx_validation_flags"`
+}
+
+// BlockDetail is the decoded block with its transactions
+type BlockDetail struct {
+	ChannelName  string               `json:"channel_name"`
+	Number       uint64               `json:"number"`
+	Hash         string               `json:"hash"`
+	DataHash     string               `json:"data_hash"`
+	PreviousHash string               `json:"previous_hash"`
+	Metadata     *BlockMetadata       `json:"metadata"`
+	Transactions []*TransactionDetail `json:"transactions"`
+}
+
+func convertBlockToDetail(channelName string, block *common.Block, opts *TxDetailOptions) (*BlockDetail, error) {
+	header := block.GetHeader()
+	detail := &BlockDetail{
+		ChannelName:  channelName,
+		Number:       header.GetNumber(),
+		Hash:         hex.EncodeToString(BlockHeaderHash(header)),
+		DataHash:     hex.EncodeToString(header.GetDataHash()),
+		PreviousHash: hex.EncodeToString(header.GetPreviousHash()),
+	}
+
+	metadata, err := parseBlockMetadata(block)
+	if err != nil {
+		return nil, err
+	}
+	detail.Metadata = metadata
+
+	var flags []byte
+	if len(block.GetMetadata().GetMetadata()) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		flags = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	detail.Transactions = make([]*TransactionDetail, 0, len(block.GetData().GetData()))
+	for i, data := range block.GetData().GetData() {
+		txFlag := int32(peer.TxValidationCode_VALID)
+		if i < len(flags) {
+			txFlag = int32(flags[i])
+		}
+
+		env, err := GetEnvelopeFromBlock(data)
+		var tx *TransactionDetail
+		if err == nil {
+			tx, err = convertEnvelopeToTXDetail(txFlag, env, opts)
+		}
+		if err != nil {
+			// 解析失败的交易不影响整个区块的展示
+			log.Printf("convert transaction %d of block %d failed: %v", i, detail.Number, err)
+			tx = failedTXDetail(txFlag, env, err)
+		}
+		tx.ChannelName = channelName
+		tx.BlockNumber = detail.Number
+		detail.Transactions = append(detail.Transactions, tx)
+	}
+
+	return detail, nil
+}
+
+// failedTXDetail 交易解析失败时尽量保留channel header中的txID、类型及时间
+func failedTXDetail(txFlag int32, env *common.Envelope, err error) *TransactionDetail {
+	tx := &TransactionDetail{
+		ValidationResult: peer.TxValidationCode_name[txFlag],
+		Error:            err.Error(),
+	}
+	if env == nil {
+		return tx
+	}
+	payload, err := GetPayload(env)
+	if err != nil || payload.Header == nil {
+		return tx
+	}
+	chdr, err := UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return tx
+	}
+	tx.ID = chdr.TxId
+	tx.Type = common.HeaderType_name[chdr.Type]
+	tx.CreatedAt = time.Unix(chdr.GetTimestamp().GetSeconds(), int64(chdr.GetTimestamp().GetNanos()))
+	return tx
+}
+
+func parseBlockMetadata(block *common.Block) (*BlockMetadata, error) {
+	metadata := &BlockMetadata{}
+
+	sigs, err := GetMetadataFromBlock(block, common.BlockMetadataIndex_SIGNATURES)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range sigs.Signatures {
+		shdr, err := GetSignatureHeader(sig.SignatureHeader)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := getIdentity(shdr.Creator)
+		if err != nil {
+			return nil, err
+		}
+		bs := &BlockSignature{MSP: identity.mspID, Signature: hex.EncodeToString(sig.Signature)}
+		if identity.cert != nil {
+			bs.Name = identity.cert.Subject.CommonName
+		}
+		metadata.Signatures = append(metadata.Signatures, bs)
+	}
+
+	// genesis block没有last config
+	if block.GetHeader().GetNumber() > 0 {
+		metadata.LastConfigIndex, err = GetLastConfigIndexFromBlock(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(block.GetMetadata().GetMetadata()) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		for _, flag := range block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] {
+			metadata.TxValidationFlags = append(metadata.TxValidationFlags, peer.TxValidationCode_name[int32(flag)])
+		}
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testConfigEnvelope 构造只含排序节点地址的CONFIG交易
+func testConfigEnvelope(t *testing.T, txID string) *common.Envelope {
+	config := &common.Config{
+		Sequence: 3,
+		ChannelGroup: &common.ConfigGroup{Values: map[string]*common.ConfigValue{
+			valueOrdererAddresses: {Value: mustMarshal(t, &common.OrdererAddresses{Addresses: []string{"orderer.example.com:7050"}})},
+		}},
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   testChannelHeader(t, common.HeaderType_CONFIG, txID, nil),
+			SignatureHeader: mustMarshal(t, &common.SignatureHeader{}),
+		},
+		Data: mustMarshal(t, &common.ConfigEnvelope{Config: config}),
+	}
+	return &common.Envelope{Payload: mustMarshal(t, payload)}
+}
+
+func TestConvertBlockToDetail(t *testing.T) {
+	fabcar := &testAction{
+		chaincode: "fabcar",
+		args:      []string{"createCar", "CAR10"},
+		nsRWSets:  []*rwset.NsReadWriteSet{testNsRWSet(t, "fabcar", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "CAR10", Value: []byte("{}")}}})},
+		response:  &peer.Response{Status: 200},
+	}
+	// channel header完整但交易内容无法解析
+	broken := &common.Envelope{Payload: mustMarshal(t, &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   testChannelHeader(t, common.HeaderType_ENDORSER_TRANSACTION, "tx4", nil),
+			SignatureHeader: mustMarshal(t, &common.SignatureHeader{}),
+		},
+		Data: []byte{0xff},
+	})}
+
+	block := &common.Block{
+		Header: &common.BlockHeader{Number: 5, PreviousHash: []byte{0x01, 0x02}, DataHash: []byte{0x03, 0x04}},
+		Data: &common.BlockData{Data: [][]byte{
+			mustMarshal(t, testEndorserEnvelope(t, "tx1", nil, fabcar)),
+			mustMarshal(t, testEndorserEnvelope(t, "tx2", nil, fabcar)),
+			mustMarshal(t, testConfigEnvelope(t, "tx3")),
+			mustMarshal(t, broken),
+			{0xff, 0xff},
+		}},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{
+			mustMarshal(t, &common.Metadata{Value: mustMarshal(t, &common.OrdererBlockMetadata{LastConfig: &common.LastConfig{Index: 2}})}),
+			{},
+			{
+				byte(peer.TxValidationCode_VALID),
+				byte(peer.TxValidationCode_MVCC_READ_CONFLICT),
+				byte(peer.TxValidationCode_VALID),
+				byte(peer.TxValidationCode_VALID),
+				byte(peer.TxValidationCode_BAD_PAYLOAD),
+			},
+		}},
+	}
+
+	detail, err := convertBlockToDetail("mychannel", block, &TxDetailOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.ChannelName != "mychannel" || detail.Number != 5 || detail.PreviousHash != "0102" || detail.DataHash != "0304" ||
+		detail.Hash != hex.EncodeToString(BlockHeaderHash(block.Header)) {
+		t.Errorf("unexpected block header %+v", detail)
+	}
+	if detail.Metadata.LastConfigIndex != 2 || len(detail.Metadata.TxValidationFlags) != 5 || detail.Metadata.TxValidationFlags[1] != "MVCC_READ_CONFLICT" {
+		t.Errorf("unexpected metadata %+v", detail.Metadata)
+	}
+	if len(detail.Transactions) != 5 {
+		t.Fatalf("expected 5 transactions, got %d", len(detail.Transactions))
+	}
+
+	tests := []struct {
+		id               string
+		txType           string
+		validationResult string
+		failed           bool
+	}{
+		{"tx1", "ENDORSER_TRANSACTION", "VALID", false},
+		{"tx2", "ENDORSER_TRANSACTION", "MVCC_READ_CONFLICT", false},
+		{"tx3", "CONFIG", "VALID", false},
+		// 解析失败时保留channel header中的信息
+		{"tx4", "ENDORSER_TRANSACTION", "VALID", true},
+		{"", "", "BAD_PAYLOAD", true},
+	}
+	for i, test := range tests {
+		tx := detail.Transactions[i]
+		if tx.ID != test.id || tx.Type != test.txType || tx.ValidationResult != test.validationResult || (tx.Error != "") != test.failed {
+			t.Errorf("transaction %d: expected %+v, got id %q type %q validation %q error %q", i, test, tx.ID, tx.Type, tx.ValidationResult, tx.Error)
+		}
+		if tx.ChannelName != "mychannel" || tx.BlockNumber != 5 {
+			t.Errorf("transaction %d: unexpected channel %s block %d", i, tx.ChannelName, tx.BlockNumber)
+		}
+		if test.id != "" && !tx.CreatedAt.Equal(testTxTime) {
+			t.Errorf("transaction %d: expected created at %v, got %v", i, testTxTime, tx.CreatedAt)
+		}
+	}
+
+	tx1 := detail.Transactions[0]
+	if tx1.ChaincodeName != "fabcar" || len(tx1.Actions) != 1 || tx1.Actions[0].Response.Status != 200 || tx1.Value.IDs[0] != "CAR10" {
+		t.Errorf("unexpected endorser transaction %+v", tx1)
+	}
+	config := detail.Transactions[2].Config
+	if config == nil || config.Sequence != 3 || len(config.OrdererAddresses) != 1 || config.OrdererAddresses[0] != "orderer.example.com:7050" {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
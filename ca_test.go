@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// fakeCA 模拟fabric-ca-server的enroll/reenroll/register/revoke接口，记录收到的caname
+type fakeCA struct {
+	caName string
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	pem    []byte
+
+	mutex    sync.Mutex
+	secrets  map[string]string
+	serial   int64
+	requests []string
+}
+
+func newFakeCA(t *testing.T, caName string) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: caName, Organization: []string{"org1.example.com"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &fakeCA{
+		caName:  caName,
+		key:     key,
+		cert:    cert,
+		pem:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		secrets: map[string]string{"admin": "adminpw"},
+		serial:  1,
+	}
+}
+
+func (ca *fakeCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req struct {
+		ID          string `json:"id"`
+		Secret      string `json:"secret"`
+		CAName      string `json:"caname"`
+		Certificate string `json:"certificate_request"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		ca.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	ca.requests = append(ca.requests, r.URL.Path+" "+req.CAName)
+	if req.CAName != "" && req.CAName != ca.caName {
+		ca.fail(w, http.StatusBadRequest, "CA '"+req.CAName+"' does not exist")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/enroll":
+		name, secret, ok := r.BasicAuth()
+		if !ok || ca.secrets[name] == "" || ca.secrets[name] != secret {
+			ca.fail(w, http.StatusUnauthorized, "Authentication failure")
+			return
+		}
+		ca.issue(w, name, req.Certificate)
+	case "/reenroll":
+		// token由已登记的身份签名，此处不校验
+		ca.issue(w, "", req.Certificate)
+	case "/register":
+		if req.Secret == "" {
+			req.Secret = req.ID + "pw"
+		}
+		ca.secrets[req.ID] = req.Secret
+		ca.succeed(w, map[string]string{"secret": req.Secret})
+	case "/revoke":
+		delete(ca.secrets, req.ID)
+		ca.succeed(w, map[string]interface{}{"RevokedCerts": []interface{}{}, "CRL": ""})
+	default:
+		ca.fail(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path)
+	}
+}
+
+func (ca *fakeCA) issue(w http.ResponseWriter, name, csrPEM string) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil {
+		ca.fail(w, http.StatusBadRequest, "invalid certificate request")
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		ca.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if name == "" {
+		name = csr.Subject.CommonName
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name, OrganizationalUnit: []string{"client"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		ca.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ca.succeed(w, map[string]interface{}{
+		"Cert": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"ServerInfo": map[string]string{
+			"CAName":  ca.caName,
+			"CAChain": base64.StdEncoding.EncodeToString(ca.pem),
+			"Version": "1.4.6",
+		},
+	})
+}
+
+func (ca *fakeCA) succeed(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result, "errors": []interface{}{}, "messages": []interface{}{}})
+}
+
+func (ca *fakeCA) fail(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "result": nil, "errors": []interface{}{map[string]interface{}{"code": status, "message": msg}}, "messages": []interface{}{}})
+}
+
+func (ca *fakeCA) received() []string {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	requests := ca.requests
+	ca.requests = nil
+	return requests
+}
+
+const caTestSDKConfig = `
+version: 1.0.0
+client:
+  organization: org1
+  logging:
+    level: error
+  cryptoconfig:
+    path: %[1]s/crypto
+  credentialStore:
+    path: %[1]s/state-store
+    cryptoStore:
+      path: %[1]s/msp
+  BCCSP:
+    security:
+      enabled: true
+      default:
+        provider: "SW"
+      hashAlgorithm: "SHA2"
+      softVerify: true
+      level: 256
+organizations:
+  org1:
+    mspid: Org1MSP
+    cryptoPath: peerOrganizations/org1.example.com/users/{username}@org1.example.com/msp
+    certificateAuthorities:
+      - ca1.org1.example.com
+      - ca2.org1.example.com
+certificateAuthorities:
+  ca1.org1.example.com:
+    url: %[2]s
+    tlsCACerts:
+      pem:
+        - |
+%[4]s
+    registrar:
+      enrollId: admin
+      enrollSecret: adminpw
+    caName: ca1
+  ca2.org1.example.com:
+    url: %[3]s
+    tlsCACerts:
+      pem:
+        - |
+%[5]s
+    registrar:
+      enrollId: admin
+      enrollSecret: adminpw
+    caName: ca2
+`
+
+// indentedCert 返回httptest服务端证书，缩进后嵌入yaml
+func indentedCert(server *httptest.Server) string {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return "          " + strings.Replace(strings.TrimSpace(string(certPEM)), "\n", "\n          ", -1)
+}
+
+// TestIdentityCAInstance 通过两个模拟的fabric-ca实例验证caName选择了正确的CA
+func TestIdentityCAInstance(t *testing.T) {
+	ca1, ca2 := newFakeCA(t, "ca1"), newFakeCA(t, "ca2")
+	server1, server2 := httptest.NewTLSServer(ca1), httptest.NewTLSServer(ca2)
+	defer server1.Close()
+	defer server2.Close()
+
+	dir, err := ioutil.TempDir("", "ca-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "crypto"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sdkConfig := fmt.Sprintf(caTestSDKConfig, dir, server1.URL, server2.URL, indentedCert(server1), indentedCert(server2))
+	testSDK, err := fabsdk.New(config.FromRaw([]byte(sdkConfig), "yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testSDK.Close()
+
+	oldSDK, oldConfig := sdk, serverConfig
+	defer func() { sdk, serverConfig = oldSDK, oldConfig }()
+	sdk = testSDK
+	serverConfig = &ServerConfig{}
+	serverConfig.OrgName = "org1"
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(ctx *gin.Context) { ctx.Set(gin.AuthUserKey, "admin") })
+	router.POST("/identity/register", registerIdentity)
+	router.POST("/identity/enroll", enrollIdentity)
+	router.POST("/identity/reenroll", reenrollIdentity)
+	router.POST("/identity/revoke", revokeIdentity)
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		// 预期收到请求的CA及其收到的请求(path caname)
+		ca       *fakeCA
+		requests []string
+	}{
+		// 首次register时先用registrar登记，sdk按用户名保存registrar，之后其他CA复用
+		{"/identity/register", `{"name":"user1","secret":"user1pw"}`, http.StatusOK, ca1, []string{"/enroll ca1", "/register ca1"}},
+		{"/identity/register", `{"name":"user2","secret":"user2pw","caName":"ca2.org1.example.com"}`, http.StatusOK, ca2, []string{"/register ca2"}},
+		{"/identity/enroll", `{"name":"user1","secret":"user1pw"}`, http.StatusOK, ca1, []string{"/enroll ca1"}},
+		{"/identity/enroll", `{"name":"user2","secret":"user2pw","caName":"ca2.org1.example.com"}`, http.StatusOK, ca2, []string{"/enroll ca2"}},
+		// user2只在ca2登记过
+		{"/identity/enroll", `{"name":"user2","secret":"user2pw"}`, http.StatusInternalServerError, ca1, []string{"/enroll ca1"}},
+		{"/identity/enroll", `{"name":"user2","secret":"wrong","caName":"ca2.org1.example.com"}`, http.StatusInternalServerError, ca2, []string{"/enroll ca2"}},
+		{"/identity/reenroll", `{"name":"user2","caName":"ca2.org1.example.com"}`, http.StatusOK, ca2, []string{"/reenroll ca2"}},
+		{"/identity/revoke", `{"name":"user2","caName":"ca2.org1.example.com"}`, http.StatusOK, ca2, []string{"/revoke ca2"}},
+		{"/identity/enroll", `{"name":"user2","secret":"user2pw","caName":"ca3.org1.example.com"}`, http.StatusInternalServerError, nil, nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, test.path, bytes.NewBufferString(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d %s", test.path, test.body, test.status, w.Code, w.Body.String())
+		}
+
+		requests1, requests2 := ca1.received(), ca2.received()
+		expected1, expected2 := []string(nil), []string(nil)
+		if test.ca == ca1 {
+			expected1 = test.requests
+		} else if test.ca == ca2 {
+			expected2 = test.requests
+		}
+		if fmt.Sprint(requests1) != fmt.Sprint(expected1) || fmt.Sprint(requests2) != fmt.Sprint(expected2) {
+			t.Errorf("%s %s: expected requests ca1 %v ca2 %v, got ca1 %v ca2 %v", test.path, test.body, expected1, expected2, requests1, requests2)
+		}
+	}
+}
@@ -1,35 +1,42 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
 	"strings"
 
+	version "github.com/hashicorp/go-version"
 	cb "github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
 	packager "github.com/hyperledger/fabric-sdk-go/pkg/fab/ccpackager/gopackager"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 )
 
 // CreateChannel 创建通道
-func CreateChannel(chID, chCfgPath, targetOrder string, signIdentity []msp.SigningIdentity, peerResMgmt *resmgmt.Client) error {
+// 返回创建通道的txID，若通道已存在则返回created为true
+func CreateChannel(chID string, chCfg io.Reader, targetOrder string, signIdentity []msp.SigningIdentity, peerResMgmt *resmgmt.Client) (fab.TransactionID, bool, error) {
 
 	// 判断是否已经创建
 	created, err := IsCreatedChannel(chID, peerResMgmt, targetOrder)
 	if err != nil {
-		return err
+		return "", false, err
 	}
 	if created {
 		log.Println(fmt.Sprintf("channel %s has already created ", chID))
-		return nil
+		return "", true, nil
 	}
 
 	//var lastConfigBlockNum uint64
@@ -37,17 +44,17 @@ func CreateChannel(chID, chCfgPath, targetOrder string, signIdentity []msp.Signi
 	// 构建请求
 	req := resmgmt.SaveChannelRequest{
 		ChannelID:         chID,
-		ChannelConfigPath: chCfgPath,
+		ChannelConfig:     chCfg,
 		SigningIdentities: signIdentity,
 	}
 
 	// 发送创建请求
-	_, err = peerResMgmt.SaveChannel(req, resmgmt.WithOrdererEndpoint(targetOrder))
+	resp, err := peerResMgmt.SaveChannel(req, resmgmt.WithOrdererEndpoint(targetOrder))
 	if err != nil {
-		return err
+		return "", false, err
 	}
 
-	return nil
+	return resp.TransactionID, false, nil
 
 }
 
@@ -74,93 +81,109 @@ func UpdateAnchorPeer(chID, chCfgPath, targetOrder string, signIdentity []msp.Si
 // JoinChannel 加入通道
 // targetPeers与peerOrgResMgmt需是同一个org下的
 // 指定身份：signPayload中选择fabsdk.context中的用户
-func JoinChannel(chID, targetOrder string, targetPeers []string, peerOrgResMgmt *resmgmt.Client) error {
-	var err error
-	realTargets := make([]string, 0)
-	// 判断是否已经加入过
+// 逐个peer加入，返回每个peer的加入结果
+func JoinChannel(chID, targetOrder string, targetPeers []string, peerOrgResMgmt *resmgmt.Client) map[string]*PeerResult {
+	results := make(map[string]*PeerResult, len(targetPeers))
 	for _, target := range targetPeers {
+		// 判断是否已经加入过
 		joined, err := IsJoinedChannel(chID, peerOrgResMgmt, target)
 		if err != nil {
-			return err
+			results[target] = &PeerResult{Status: PeerStatusFailed, Error: err.Error()}
+			continue
 		}
 		if joined {
 			log.Println(fmt.Sprintf("%s has already joined channel %s", target, chID))
-			return nil
+			results[target] = &PeerResult{Status: PeerStatusAlreadyMember}
+			continue
 		}
-		realTargets = append(realTargets, target)
 
-	}
-
-	// 加入通道
-	if len(realTargets) > 0 {
+		// 加入通道
 		err = peerOrgResMgmt.JoinChannel(
 			chID,
 			resmgmt.WithRetry(retry.DefaultResMgmtOpts),
 			resmgmt.WithOrdererEndpoint(targetOrder),
-			resmgmt.WithTargetEndpoints(realTargets...),
+			resmgmt.WithTargetEndpoints(target),
 		)
 		if err != nil {
-			return err
+			results[target] = &PeerResult{Status: PeerStatusFailed, Error: err.Error()}
+			continue
 		}
-
+		results[target] = &PeerResult{Status: PeerStatusJoined}
 	}
 
-	return nil
+	return results
 }
 
 // InstallCC 安装chaincode
 // targetPeers与peerOrgResMgmt需是同一个org下的
 // cc install是针对peer的，每个peer都得执行一遍
 // 指定身份：signProposal中选择fabsdk.context中的用户
-func InstallCC(ccID, ccVersion, ccPath string, targetPeers []string, peerOrgResMgmt *resmgmt.Client) error {
+// ccPkg为空时根据ccPath打包，返回每个peer的安装结果
+func InstallCC(ccID, ccVersion, ccPath string, ccPkg *resource.CCPackage, targetPeers []string, peerOrgResMgmt *resmgmt.Client) map[string]*PeerResult {
+	results := make(map[string]*PeerResult, len(targetPeers))
 
 	realTargets := make([]string, 0)
 	// 判断是否已经install
 	for _, target := range targetPeers {
 		installed, err := IsCCInstalled(peerOrgResMgmt, ccID, ccVersion, target)
 		if err != nil {
-			return err
+			results[target] = &PeerResult{Status: PeerStatusFailed, Error: err.Error()}
+			continue
 		}
 		if installed {
 			log.Println(fmt.Sprintf("%s has already installed cc %s:%s", target, ccID, ccVersion))
-			return nil
+			results[target] = &PeerResult{Status: PeerStatusAlreadyInstalled}
+			continue
 		}
 		realTargets = append(realTargets, target)
 
 	}
 
-	if len(realTargets) > 0 {
-		ccPkg, err := packager.NewCCPackage(ccPath, "")
+	if len(realTargets) == 0 {
+		return results
+	}
+
+	if ccPkg == nil {
+		var err error
+		ccPkg, err = packager.NewCCPackage(ccPath, "")
 		if err != nil {
-			return err
+			for _, target := range realTargets {
+				results[target] = &PeerResult{Status: PeerStatusFailed, Error: err.Error()}
+			}
+			return results
 		}
+	}
 
-		// 构建请求
-		pwd, _ := os.Getwd()
-		ccAbsPath := path.Join(pwd, ccPath)
-		req := resmgmt.InstallCCRequest{
-			Name:    ccID,
-			Path:    ccAbsPath,
-			Version: ccVersion,
-			Package: ccPkg,
-		}
+	// 构建请求
+	pwd, _ := os.Getwd()
+	ccAbsPath := path.Join(pwd, ccPath)
+	req := resmgmt.InstallCCRequest{
+		Name:    ccID,
+		Path:    ccAbsPath,
+		Version: ccVersion,
+		Package: ccPkg,
+	}
 
-		// install cc
-		_, err = peerOrgResMgmt.InstallCC(req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(realTargets...))
+	// install cc，逐个peer安装以便记录每个peer的结果
+	for _, target := range realTargets {
+		_, err := peerOrgResMgmt.InstallCC(req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(target))
 		if err != nil {
-			return err
+			results[target] = &PeerResult{Status: PeerStatusFailed, Error: err.Error()}
+			continue
 		}
-
+		results[target] = &PeerResult{Status: PeerStatusInstalled}
 	}
 
-	return nil
+	return results
 }
 
 // InstantiateCC 实例化chaincode
 // targetPeers与peerOrgResMgmt需是同一个org下的
 // cc instantiate是针对channel的，只需执行一遍
 // 指定身份：signProposal中选择fabsdk.context中的用户
-func InstantiateCC(chID, ccID, ccVersion, ccPath string, ccPolicy *cb.SignaturePolicyEnvelope, targetPeers []string, peerOrgResMgmt *resmgmt.Client) error {
+// 若已实例化则返回的txID为空
+// 已实例化其他版本时，upgrade为true才执行升级，否则返回错误
+func InstantiateCC(chID, ccID, ccVersion, ccPath string, args [][]byte, ccPolicy *cb.SignaturePolicyEnvelope, collConfig []*pb.CollectionConfig, targetPeers []string, peerOrgResMgmt *resmgmt.Client, upgrade bool) (fab.TransactionID, error) {
 
 	// 判断是否已经instantiated
 	var code string
@@ -168,7 +191,7 @@ func InstantiateCC(chID, ccID, ccVersion, ccPath string, ccPolicy *cb.SignatureP
 	for _, target := range targetPeers {
 		code, err = InstantiateOrUpdate(peerOrgResMgmt, chID, ccID, ccVersion, target)
 		if err != nil {
-			return err
+			return "", err
 		}
 		break // 针对channel而言，instantiated判断执行一遍即可
 	}
@@ -181,33 +204,42 @@ func InstantiateCC(chID, ccID, ccVersion, ccPath string, ccPolicy *cb.SignatureP
 	case "1":
 		// 构建请求
 		req := resmgmt.InstantiateCCRequest{
-			Name:    ccID,
-			Path:    ccAbsPath,
-			Version: ccVersion,
-			Policy:  ccPolicy,
+			Name:       ccID,
+			Path:       ccAbsPath,
+			Version:    ccVersion,
+			Args:       args,
+			Policy:     ccPolicy,
+			CollConfig: collConfig,
 		}
 		// instantiate cc
-		_, err := peerOrgResMgmt.InstantiateCC(chID, req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(targetPeers...))
+		resp, err := peerOrgResMgmt.InstantiateCC(chID, req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(targetPeers...))
 		if err != nil {
-			return err
+			return "", err
 		}
-		//log.Println(fmt.Sprintf("%v in channel %s instantiate cc %s:%s success, txId is %s", targetPeers, chID, ccID, ccVersion, resp.TransactionID))
+		log.Println(fmt.Sprintf("%v in channel %s instantiate cc %s:%s success, txId is %s", targetPeers, chID, ccID, ccVersion, resp.TransactionID))
+		return resp.TransactionID, nil
 	case "2":
+		if !upgrade {
+			return "", fmt.Errorf("channel %s has instantiated another version of cc %s", chID, ccID)
+		}
 		req := resmgmt.UpgradeCCRequest{
-			Name:    ccID,
-			Path:    ccAbsPath,
-			Version: ccVersion,
-			Policy:  ccPolicy,
+			Name:       ccID,
+			Path:       ccAbsPath,
+			Version:    ccVersion,
+			Args:       args,
+			Policy:     ccPolicy,
+			CollConfig: collConfig,
 		}
 		// upgrade cc
-		_, err := peerOrgResMgmt.UpgradeCC(chID, req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(targetPeers...))
+		resp, err := peerOrgResMgmt.UpgradeCC(chID, req, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(targetPeers...))
 		if err != nil {
-			return err
+			return "", err
 		}
-		//log.Println(fmt.Sprintf("%v in channel %s upgrade cc %s:%s success, txId is %s", targetPeers, chID, ccID, ccVersion, resp.TransactionID))
+		log.Println(fmt.Sprintf("%v in channel %s upgrade cc %s:%s success, txId is %s", targetPeers, chID, ccID, ccVersion, resp.TransactionID))
+		return resp.TransactionID, nil
 	}
 
-	return nil
+	return "", nil
 }
 
 // InvokeCC 调用chaincode
@@ -223,6 +255,23 @@ func InvokeCC(chClient *channel.Client, req channel.Request) (*channel.Response,
 	return &response, nil
 }
 
+// InvokeCCAsync 使用自定义的提交handler调用链码，handler在背书完成后通知调用方
+// 返回给客户端的txID需保持不变，因此不做重试
+func InvokeCCAsync(chClient *channel.Client, req channel.Request, commitHandler invoke.Handler) (*channel.Response, error) {
+
+	handler := invoke.NewSelectAndEndorseHandler(
+		invoke.NewEndorsementValidationHandler(
+			invoke.NewSignatureValidationHandler(commitHandler),
+		),
+	)
+	response, err := chClient.InvokeHandler(handler, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
 // QueryCC 查询
 // 指定身份：signProposal中选择fabsdk.context中的用户
 func QueryCC(chClient *channel.Client, req channel.Request) (*channel.Response, error) {
@@ -261,6 +310,18 @@ func QueryBlockByTxID(ldgCLient *ledger.Client, txID string, targetPeer string)
 
 }
 
+// QueryBlockByHash 通过区块hash查询区块
+func QueryBlockByHash(ldgCLient *ledger.Client, hash []byte, targetPeer string) (*cb.Block, error) {
+
+	block, err := ldgCLient.QueryBlockByHash(hash, ledger.WithTargetEndpoints(targetPeer))
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+
+}
+
 // IsCreatedChannel 判读通道是否已创建
 func IsCreatedChannel(channelID string, resMgmtClient *resmgmt.Client, targetOrder string) (bool, error) {
 
@@ -283,18 +344,48 @@ func IsCreatedChannel(channelID string, resMgmtClient *resmgmt.Client, targetOrd
 // 只能一个一个peer的查询
 func IsJoinedChannel(channelID string, resMgmtClient *resmgmt.Client, targetPeer string) (bool, error) {
 
-	resp, err := resMgmtClient.QueryChannels(resmgmt.WithTargetEndpoints(targetPeer))
+	channels, err := QueryJoinedChannels(resMgmtClient, targetPeer)
 	if err != nil {
 		return false, err
 	}
-	for _, chInfo := range resp.Channels {
-		if chInfo.ChannelId == channelID {
+	for _, ch := range channels {
+		if ch == channelID {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
+// QueryJoinedChannels 查询peer已加入的通道
+// 只能一个一个peer的查询
+func QueryJoinedChannels(resMgmtClient *resmgmt.Client, targetPeer string) ([]string, error) {
+
+	resp, err := resMgmtClient.QueryChannels(resmgmt.WithTargetEndpoints(targetPeer))
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]string, 0, len(resp.Channels))
+	for _, chInfo := range resp.Channels {
+		channels = append(channels, chInfo.ChannelId)
+	}
+	return channels, nil
+}
+
+// QueryLedgerInfo 查询peer上通道账本的块高及区块hash
+func QueryLedgerInfo(ldgCLient *ledger.Client, targetPeer string) (*LedgerInfo, error) {
+
+	resp, err := ldgCLient.QueryInfo(ledger.WithTargetEndpoints(targetPeer))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LedgerInfo{
+		Height:            resp.BCI.GetHeight(),
+		CurrentBlockHash:  hex.EncodeToString(resp.BCI.GetCurrentBlockHash()),
+		PreviousBlockHash: hex.EncodeToString(resp.BCI.GetPreviousBlockHash()),
+	}, nil
+}
+
 // IsCCInstalled chaincode是否已安装
 // 只能一个一个peer的查询
 func IsCCInstalled(resMgmt *resmgmt.Client, ccName, ccVersion string, targetPeer string) (bool, error) {
@@ -333,6 +424,37 @@ func IsCCInstantiated(resMgmt *resmgmt.Client, channelID, ccName, ccVersion stri
 	return instantiated, nil
 }
 
+// QueryInstantiatedVersion 查询通道上已实例化的chaincode版本
+// 只能一个一个peer的查询，未实例化时返回空字符串
+func QueryInstantiatedVersion(resMgmt *resmgmt.Client, channelID, ccName string, targetPeer string) (string, error) {
+
+	resp, err := resMgmt.QueryInstantiatedChaincodes(channelID, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(targetPeer))
+	if err != nil {
+		return "", err
+	}
+	for _, ccInfo := range resp.Chaincodes {
+		if ccInfo.Name == ccName {
+			return ccInfo.Version, nil
+		}
+	}
+
+	return "", nil
+}
+
+// IsDowngrade 判断newVersion是否低于oldVersion
+// 版本号无法按语义化版本解析时不视为降级
+func IsDowngrade(oldVersion, newVersion string) bool {
+	oldV, err := version.NewVersion(oldVersion)
+	if err != nil {
+		return false
+	}
+	newV, err := version.NewVersion(newVersion)
+	if err != nil {
+		return false
+	}
+	return newV.LessThan(oldV)
+}
+
 // InstantiateOrUpdate 实例化或更新
 // 只能一个一个peer的查询: 0，已instantiated；1，需要instantiate；2，需要update
 func InstantiateOrUpdate(resMgmt *resmgmt.Client, channelID, ccName, ccVersion string, targetPeer string) (string, error) {
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// config group and value keys of channel config
+const (
+	groupApplication = "Application"
+	groupOrderer     = "Orderer"
+	groupConsortiums = "Consortiums"
+
+	valueMSP                       = "MSP"
+	valueAnchorPeers               = "AnchorPeers"
+	valueEndpoints                 = "Endpoints"
+	valueOrdererAddresses          = "OrdererAddresses"
+	valueBatchSize                 = "BatchSize"
+	valueBatchTimeout              = "BatchTimeout"
+	valueConsensusType             = "ConsensusType"
+	valueCapabilities              = "Capabilities"
+	valueHashingAlgorithm          = "HashingAlgorithm"
+	valueBlockDataHashingStructure = "BlockDataHashingStructure"
+	valueConsortium                = "Consortium"
+	valueACLs                      = "ACLs"
+)
+
+// OrgConfig is the config of an organization in the channel
+type OrgConfig struct {
+	Name        string            `json:"name"`
+	MSPID       string            `json:"msp_id"`
+	AnchorPeers []string          `json:"anchor_peers,omitempty"`
+	Endpoints   []string          `json:"endpoints,omitempty"`
+	Policies    map[string]string `json:"policies,omitempty"`
+}
+
+// BatchSize is the batch size of the orderer
+type BatchSize struct {
+	MaxMessageCount   uint32 `json:"max_message_count"`
+	AbsoluteMaxBytes  uint32 `json:"absolute_max_bytes"`
+	PreferredMaxBytes uint32 `json:"preferred_max_bytes"`
+}
+
+// ChannelConfig is the decoded config of a channel
+type ChannelConfig struct {
+	Sequence         uint64              `json:"sequence"`
+	Consortium       string              `json:"consortium,omitempty"`
+	Orgs             []*OrgConfig        `json:"orgs"`
+	OrdererOrgs      []*OrgConfig        `json:"orderer_orgs"`
+	OrdererAddresses []string            `json:"orderer_addresses"`
+	ConsensusType    string              `json:"consensus_type"`
+	BatchSize        *BatchSize          `json:"batch_size,omitempty"`
+	BatchTimeout     string              `json:"batch_timeout"`
+	Capabilities     map[string][]string `json:"capabilities,omitempty"`
+	Policies         map[string]string   `json:"policies"`
+}
+
+// ConfigValueDetail is a value of a config group
+type ConfigValueDetail struct {
+	Version   uint64      `json:"version"`
+	ModPolicy string      `json:"mod_policy,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+}
+
+// ConfigPolicyDetail is a policy of a config group
+type ConfigPolicyDetail struct {
+	Version   uint64 `json:"version"`
+	ModPolicy string `json:"mod_policy,omitempty"`
+	Rule      string `json:"rule,omitempty"`
+}
+
+// ConfigGroupDetail is the decoded config group tree
+type ConfigGroupDetail struct {
+	Version   uint64                         `json:"version"`
+	ModPolicy string                         `json:"mod_policy,omitempty"`
+	Groups    map[string]*ConfigGroupDetail  `json:"groups,omitempty"`
+	Values    map[string]*ConfigValueDetail  `json:"values,omitempty"`
+	Policies  map[string]*ConfigPolicyDetail `json:"policies,omitempty"`
+}
+
+// ConfigUpdateDetail is the decoded config update with its signers
+type ConfigUpdateDetail struct {
+	ChannelID string             `json:"channel_id"`
+	ReadSet   *ConfigGroupDetail `json:"read_set"`
+	WriteSet  *ConfigGroupDetail `json:"write_set"`
+	Signers   []*Endorser        `json:"signers"`
+}
+
+// parseConfigEnvelope 解析CONFIG类型交易，返回通道配置及引起该配置的更新
+func parseConfigEnvelope(data []byte) (*ChannelConfig, *ConfigUpdateDetail, error) {
+	configEnv := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(data, configEnv); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling ConfigEnvelope: %v", err)
+	}
+	if configEnv.Config == nil {
+		return nil, nil, fmt.Errorf("config envelope has no config")
+	}
+
+	config, err := convertChannelConfig(configEnv.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// genesis block没有LastUpdate
+	if configEnv.LastUpdate == nil {
+		return config, nil, nil
+	}
+	payload, err := GetPayload(configEnv.LastUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+	update, err := parseConfigUpdateEnvelope(payload.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, update, nil
+}
+
+// parseConfigUpdateEnvelope 解析CONFIG_UPDATE类型交易
+func parseConfigUpdateEnvelope(data []byte) (*ConfigUpdateDetail, error) {
+	updateEnv := &common.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(data, updateEnv); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ConfigUpdateEnvelope: %v", err)
+	}
+	update := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(updateEnv.ConfigUpdate, update); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ConfigUpdate: %v", err)
+	}
+
+	detail := &ConfigUpdateDetail{
+		ChannelID: update.ChannelId,
+		ReadSet:   convertConfigGroup(update.ReadSet),
+		WriteSet:  convertConfigGroup(update.WriteSet),
+		Signers:   make([]*Endorser, 0, len(updateEnv.Signatures)),
+	}
+	for _, sig := range updateEnv.Signatures {
+		shdr, err := GetSignatureHeader(sig.SignatureHeader)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := getIdentity(shdr.Creator)
+		if err != nil {
+			return nil, err
+		}
+		signer := &Endorser{MSP: identity.mspID, Identity: identity.info()}
+		if identity.cert != nil {
+			signer.Name = identity.cert.Subject.CommonName
+		}
+		detail.Signers = append(detail.Signers, signer)
+	}
+	return detail, nil
+}
+
+func convertChannelConfig(config *common.Config) (*ChannelConfig, error) {
+	channelConfig := &ChannelConfig{
+		Sequence:     config.Sequence,
+		Orgs:         make([]*OrgConfig, 0),
+		OrdererOrgs:  make([]*OrgConfig, 0),
+		Capabilities: make(map[string][]string),
+		Policies:     make(map[string]string),
+	}
+
+	root := config.GetChannelGroup()
+	if root == nil {
+		return channelConfig, nil
+	}
+	collectPolicies("/Channel", root, channelConfig.Policies)
+
+	if v, ok := root.Values[valueOrdererAddresses]; ok {
+		addresses := &common.OrdererAddresses{}
+		if err := proto.Unmarshal(v.Value, addresses); err != nil {
+			return nil, fmt.Errorf("error unmarshaling OrdererAddresses: %v", err)
+		}
+		channelConfig.OrdererAddresses = addresses.Addresses
+	}
+	if v, ok := root.Values[valueConsortium]; ok {
+		consortium := &common.Consortium{}
+		if err := proto.Unmarshal(v.Value, consortium); err != nil {
+			return nil, fmt.Errorf("error unmarshaling Consortium: %v", err)
+		}
+		channelConfig.Consortium = consortium.Name
+	}
+	if capabilities := decodeCapabilities(root); capabilities != nil {
+		channelConfig.Capabilities["Channel"] = capabilities
+	}
+
+	if app, ok := root.Groups[groupApplication]; ok {
+		orgs, err := convertOrgs(app)
+		if err != nil {
+			return nil, err
+		}
+		channelConfig.Orgs = orgs
+		if capabilities := decodeCapabilities(app); capabilities != nil {
+			channelConfig.Capabilities[groupApplication] = capabilities
+		}
+	}
+
+	// 系统通道的组织在Consortiums下
+	if consortiums, ok := root.Groups[groupConsortiums]; ok {
+		for _, name := range sortedGroupNames(consortiums.Groups) {
+			orgs, err := convertOrgs(consortiums.Groups[name])
+			if err != nil {
+				return nil, err
+			}
+			channelConfig.Orgs = append(channelConfig.Orgs, orgs...)
+		}
+	}
+
+	if ord, ok := root.Groups[groupOrderer]; ok {
+		orgs, err := convertOrgs(ord)
+		if err != nil {
+			return nil, err
+		}
+		channelConfig.OrdererOrgs = orgs
+		if capabilities := decodeCapabilities(ord); capabilities != nil {
+			channelConfig.Capabilities[groupOrderer] = capabilities
+		}
+
+		if v, ok := ord.Values[valueConsensusType]; ok {
+			consensusType := &orderer.ConsensusType{}
+			if err := proto.Unmarshal(v.Value, consensusType); err != nil {
+				return nil, fmt.Errorf("error unmarshaling ConsensusType: %v", err)
+			}
+			channelConfig.ConsensusType = consensusType.Type
+		}
+		if v, ok := ord.Values[valueBatchSize]; ok {
+			batchSize := &orderer.BatchSize{}
+			if err := proto.Unmarshal(v.Value, batchSize); err != nil {
+				return nil, fmt.Errorf("error unmarshaling BatchSize: %v", err)
+			}
+			channelConfig.BatchSize = &BatchSize{
+				MaxMessageCount:   batchSize.MaxMessageCount,
+				AbsoluteMaxBytes:  batchSize.AbsoluteMaxBytes,
+				PreferredMaxBytes: batchSize.PreferredMaxBytes,
+			}
+		}
+		if v, ok := ord.Values[valueBatchTimeout]; ok {
+			batchTimeout := &orderer.BatchTimeout{}
+			if err := proto.Unmarshal(v.Value, batchTimeout); err != nil {
+				return nil, fmt.Errorf("error unmarshaling BatchTimeout: %v", err)
+			}
+			channelConfig.BatchTimeout = batchTimeout.Timeout
+		}
+	}
+
+	return channelConfig, nil
+}
+
+func convertOrgs(group *common.ConfigGroup) ([]*OrgConfig, error) {
+	orgs := make([]*OrgConfig, 0, len(group.Groups))
+	for _, name := range sortedGroupNames(group.Groups) {
+		orgGroup := group.Groups[name]
+		org := &OrgConfig{Name: name, Policies: make(map[string]string)}
+		collectPolicies("", orgGroup, org.Policies)
+
+		if v, ok := orgGroup.Values[valueMSP]; ok {
+			mspID, err := decodeMSPID(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			org.MSPID = mspID
+		}
+		if v, ok := orgGroup.Values[valueAnchorPeers]; ok {
+			anchorPeers, err := decodeAnchorPeers(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			org.AnchorPeers = anchorPeers
+		}
+		if v, ok := orgGroup.Values[valueEndpoints]; ok {
+			addresses := &common.OrdererAddresses{}
+			if err := proto.Unmarshal(v.Value, addresses); err != nil {
+				return nil, fmt.Errorf("error unmarshaling Endpoints: %v", err)
+			}
+			org.Endpoints = addresses.Addresses
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+// collectPolicies 收集group下的所有策略，key为策略路径
+func collectPolicies(path string, group *common.ConfigGroup, policies map[string]string) {
+	for name, policy := range group.Policies {
+		key := name
+		if path != "" {
+			key = path + "/" + name
+		}
+		policies[key] = renderPolicy(policy.GetPolicy())
+	}
+	if path == "" {
+		return
+	}
+	for name, sub := range group.Groups {
+		collectPolicies(path+"/"+name, sub, policies)
+	}
+}
+
+func convertConfigGroup(group *common.ConfigGroup) *ConfigGroupDetail {
+	if group == nil {
+		return nil
+	}
+
+	detail := &ConfigGroupDetail{Version: group.Version, ModPolicy: group.ModPolicy}
+	if len(group.Groups) > 0 {
+		detail.Groups = make(map[string]*ConfigGroupDetail, len(group.Groups))
+		for name, sub := range group.Groups {
+			detail.Groups[name] = convertConfigGroup(sub)
+		}
+	}
+	if len(group.Values) > 0 {
+		detail.Values = make(map[string]*ConfigValueDetail, len(group.Values))
+		for name, value := range group.Values {
+			detail.Values[name] = &ConfigValueDetail{
+				Version:   value.Version,
+				ModPolicy: value.ModPolicy,
+				Value:     decodeConfigValue(name, value.Value),
+			}
+		}
+	}
+	if len(group.Policies) > 0 {
+		detail.Policies = make(map[string]*ConfigPolicyDetail, len(group.Policies))
+		for name, policy := range group.Policies {
+			detail.Policies[name] = &ConfigPolicyDetail{
+				Version:   policy.Version,
+				ModPolicy: policy.ModPolicy,
+				Rule:      renderPolicy(policy.GetPolicy()),
+			}
+		}
+	}
+	return detail
+}
+
+// decodeConfigValue 按key解析已知的配置值，未知的以base64返回
+// read set中的value通常为空
+func decodeConfigValue(key string, value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+
+	var msg proto.Message
+	switch key {
+	case valueMSP:
+		if mspID, err := decodeMSPID(value); err == nil {
+			return map[string]string{"msp_id": mspID}
+		}
+	case valueAnchorPeers:
+		if anchorPeers, err := decodeAnchorPeers(value); err == nil {
+			return anchorPeers
+		}
+	case valueEndpoints, valueOrdererAddresses:
+		msg = &common.OrdererAddresses{}
+	case valueBatchSize:
+		msg = &orderer.BatchSize{}
+	case valueBatchTimeout:
+		msg = &orderer.BatchTimeout{}
+	case valueConsensusType:
+		consensusType := &orderer.ConsensusType{}
+		if err := proto.Unmarshal(value, consensusType); err == nil {
+			return map[string]interface{}{"type": consensusType.Type, "state": consensusType.State.String()}
+		}
+	case valueCapabilities:
+		capabilities := &common.Capabilities{}
+		if err := proto.Unmarshal(value, capabilities); err == nil {
+			return sortedCapabilities(capabilities)
+		}
+	case valueHashingAlgorithm:
+		msg = &common.HashingAlgorithm{}
+	case valueBlockDataHashingStructure:
+		msg = &common.BlockDataHashingStructure{}
+	case valueConsortium:
+		msg = &common.Consortium{}
+	case valueACLs:
+		acls := &peer.ACLs{}
+		if err := proto.Unmarshal(value, acls); err == nil {
+			result := make(map[string]string, len(acls.Acls))
+			for resource, ref := range acls.Acls {
+				result[resource] = ref.GetPolicyRef()
+			}
+			return result
+		}
+	}
+
+	if msg != nil {
+		if err := proto.Unmarshal(value, msg); err == nil {
+			return msg
+		}
+	}
+	return base64.StdEncoding.EncodeToString(value)
+}
+
+func decodeMSPID(value []byte) (string, error) {
+	_, mspID, err := decodeMSPConfig(value)
+	return mspID, err
+}
+
+// decodeMSPConfig 解析组织的MSP配置值，返回MSP配置及其MSPID
+func decodeMSPConfig(value []byte) (*mspproto.MSPConfig, string, error) {
+	mspConfig := &mspproto.MSPConfig{}
+	if err := proto.Unmarshal(value, mspConfig); err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling MSPConfig: %v", err)
+	}
+	// type 0 为 FABRIC，1 为 IDEMIX
+	if mspConfig.Type != 0 {
+		idemixConfig := &mspproto.IdemixMSPConfig{}
+		if err := proto.Unmarshal(mspConfig.Config, idemixConfig); err != nil {
+			return nil, "", fmt.Errorf("error unmarshaling IdemixMSPConfig: %v", err)
+		}
+		return mspConfig, idemixConfig.Name, nil
+	}
+	fabricConfig := &mspproto.FabricMSPConfig{}
+	if err := proto.Unmarshal(mspConfig.Config, fabricConfig); err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling FabricMSPConfig: %v", err)
+	}
+	return mspConfig, fabricConfig.Name, nil
+}
+
+func decodeAnchorPeers(value []byte) ([]string, error) {
+	anchorPeers := &peer.AnchorPeers{}
+	if err := proto.Unmarshal(value, anchorPeers); err != nil {
+		return nil, fmt.Errorf("error unmarshaling AnchorPeers: %v", err)
+	}
+	result := make([]string, 0, len(anchorPeers.AnchorPeers))
+	for _, ap := range anchorPeers.AnchorPeers {
+		result = append(result, fmt.Sprintf("%s:%d", ap.Host, ap.Port))
+	}
+	return result, nil
+}
+
+func decodeCapabilities(group *common.ConfigGroup) []string {
+	v, ok := group.Values[valueCapabilities]
+	if !ok {
+		return nil
+	}
+	capabilities := &common.Capabilities{}
+	if err := proto.Unmarshal(v.Value, capabilities); err != nil {
+		return nil
+	}
+	return sortedCapabilities(capabilities)
+}
+
+func sortedCapabilities(capabilities *common.Capabilities) []string {
+	result := make([]string, 0, len(capabilities.Capabilities))
+	for name := range capabilities.Capabilities {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sortedGroupNames(groups map[string]*common.ConfigGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderPolicy 将策略转换为可读的字符串
+// IMPLICIT_META 如 "ANY Readers"，SIGNATURE 如 "OR('Org1MSP.member')"
+func renderPolicy(policy *common.Policy) string {
+	if policy == nil {
+		return ""
+	}
+
+	switch common.Policy_PolicyType(policy.Type) {
+	case common.Policy_IMPLICIT_META:
+		imp := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(policy.Value, imp); err != nil {
+			return fmt.Sprintf("invalid implicit meta policy: %v", err)
+		}
+		return fmt.Sprintf("%s %s", imp.Rule.String(), imp.SubPolicy)
+	case common.Policy_SIGNATURE:
+		env := &common.SignaturePolicyEnvelope{}
+		if err := proto.Unmarshal(policy.Value, env); err != nil {
+			return fmt.Sprintf("invalid signature policy: %v", err)
+		}
+		return renderSignaturePolicy(env)
+	default:
+		return common.Policy_PolicyType_name[int32(policy.Type)]
+	}
+}
+
+// renderSignaturePolicy 将SignaturePolicyEnvelope转换为背书策略表达式
+func renderSignaturePolicy(env *common.SignaturePolicyEnvelope) string {
+	principals := make([]string, len(env.Identities))
+	for i, id := range env.Identities {
+		principals[i] = renderPrincipal(id)
+	}
+	return renderSignatureRule(env.Rule, principals)
+}
+
+func renderSignatureRule(rule *common.SignaturePolicy, principals []string) string {
+	if rule == nil {
+		return ""
+	}
+	if nOutOf := rule.GetNOutOf(); nOutOf != nil {
+		subs := make([]string, 0, len(nOutOf.Rules))
+		for _, sub := range nOutOf.Rules {
+			subs = append(subs, renderSignatureRule(sub, principals))
+		}
+		switch {
+		case nOutOf.N == 1 && len(subs) > 1:
+			return "OR(" + strings.Join(subs, ", ") + ")"
+		case int(nOutOf.N) == len(subs) && len(subs) > 1:
+			return "AND(" + strings.Join(subs, ", ") + ")"
+		default:
+			return fmt.Sprintf("OutOf(%d, %s)", nOutOf.N, strings.Join(subs, ", "))
+		}
+	}
+
+	idx := int(rule.GetSignedBy())
+	if idx < 0 || idx >= len(principals) {
+		return fmt.Sprintf("'<unknown principal %d>'", idx)
+	}
+	return principals[idx]
+}
+
+func renderPrincipal(principal *mspproto.MSPPrincipal) string {
+	switch principal.PrincipalClassification {
+	case mspproto.MSPPrincipal_ROLE:
+		role := &mspproto.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return "'<invalid role>'"
+		}
+		return fmt.Sprintf("'%s.%s'", role.MspIdentifier, strings.ToLower(role.Role.String()))
+	case mspproto.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &mspproto.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.Principal, ou); err != nil {
+			return "'<invalid ou>'"
+		}
+		return fmt.Sprintf("'%s.OU:%s'", ou.MspIdentifier, ou.OrganizationalUnitIdentifier)
+	default:
+		return fmt.Sprintf("'<%s>'", principal.PrincipalClassification.String())
+	}
+}
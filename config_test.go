@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func signedBy(index int32) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: index}}
+}
+
+func nOutOf(n int32, rules ...*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: n, Rules: rules}}}
+}
+
+func testRolePrincipal(t *testing.T, mspID string, role mspproto.MSPRole_MSPRoleType) *mspproto.MSPPrincipal {
+	return &mspproto.MSPPrincipal{
+		PrincipalClassification: mspproto.MSPPrincipal_ROLE,
+		Principal:               mustMarshal(t, &mspproto.MSPRole{MspIdentifier: mspID, Role: role}),
+	}
+}
+
+func testSignaturePolicy(t *testing.T, rule *common.SignaturePolicy, principals ...*mspproto.MSPPrincipal) *common.ConfigPolicy {
+	env := &common.SignaturePolicyEnvelope{Rule: rule, Identities: principals}
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_SIGNATURE), Value: mustMarshal(t, env)}}
+}
+
+func testImplicitMetaPolicy(t *testing.T, rule common.ImplicitMetaPolicy_Rule, subPolicy string) *common.ConfigPolicy {
+	imp := &common.ImplicitMetaPolicy{Rule: rule, SubPolicy: subPolicy}
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_IMPLICIT_META), Value: mustMarshal(t, imp)}}
+}
+
+func testMSPValue(t *testing.T, mspID string) *common.ConfigValue {
+	return &common.ConfigValue{Value: mustMarshal(t, &mspproto.MSPConfig{Config: mustMarshal(t, &mspproto.FabricMSPConfig{Name: mspID})})}
+}
+
+func testCapabilities(t *testing.T, names ...string) *common.ConfigValue {
+	capabilities := &common.Capabilities{Capabilities: make(map[string]*common.Capability)}
+	for _, name := range names {
+		capabilities.Capabilities[name] = &common.Capability{}
+	}
+	return &common.ConfigValue{Value: mustMarshal(t, capabilities)}
+}
+
+// testChannelConfig 两个应用组织、一个排序组织的通道配置
+func testChannelConfig(t *testing.T) *common.Config {
+	org := func(mspID, host string) *common.ConfigGroup {
+		return &common.ConfigGroup{
+			Values: map[string]*common.ConfigValue{
+				valueMSP:         testMSPValue(t, mspID),
+				valueAnchorPeers: {Value: mustMarshal(t, &peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: host, Port: 7051}}})},
+			},
+			Policies: map[string]*common.ConfigPolicy{
+				"Readers": testSignaturePolicy(t, nOutOf(1, signedBy(0), signedBy(1)),
+					testRolePrincipal(t, mspID, mspproto.MSPRole_ADMIN), testRolePrincipal(t, mspID, mspproto.MSPRole_PEER)),
+			},
+		}
+	}
+	return &common.Config{
+		Sequence: 7,
+		ChannelGroup: &common.ConfigGroup{
+			Values: map[string]*common.ConfigValue{
+				valueOrdererAddresses: {Value: mustMarshal(t, &common.OrdererAddresses{Addresses: []string{"orderer.example.com:7050"}})},
+				valueCapabilities:     testCapabilities(t, "V2_0"),
+			},
+			Policies: map[string]*common.ConfigPolicy{
+				"Readers": testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ANY, "Readers"),
+				"Admins":  testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_MAJORITY, "Admins"),
+			},
+			Groups: map[string]*common.ConfigGroup{
+				groupApplication: {
+					Values: map[string]*common.ConfigValue{valueCapabilities: testCapabilities(t, "V2_0", "V1_4_2")},
+					Groups: map[string]*common.ConfigGroup{
+						"Org2MSP": org("Org2MSP", "peer0.org2.example.com"),
+						"Org1MSP": org("Org1MSP", "peer0.org1.example.com"),
+					},
+				},
+				groupOrderer: {
+					Values: map[string]*common.ConfigValue{
+						valueConsensusType: {Value: mustMarshal(t, &orderer.ConsensusType{Type: "etcdraft"})},
+						valueBatchSize:     {Value: mustMarshal(t, &orderer.BatchSize{MaxMessageCount: 10, AbsoluteMaxBytes: 99 * 1024 * 1024, PreferredMaxBytes: 512 * 1024})},
+						valueBatchTimeout:  {Value: mustMarshal(t, &orderer.BatchTimeout{Timeout: "2s"})},
+					},
+					Groups: map[string]*common.ConfigGroup{
+						"OrdererOrg": {Values: map[string]*common.ConfigValue{
+							valueMSP:       testMSPValue(t, "OrdererMSP"),
+							valueEndpoints: {Value: mustMarshal(t, &common.OrdererAddresses{Addresses: []string{"orderer.example.com:7050"}})},
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestConvertChannelConfig(t *testing.T) {
+	config, err := convertChannelConfig(testChannelConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"sequence":7,` +
+		`"orgs":[{"name":"Org1MSP","msp_id":"Org1MSP","anchor_peers":["peer0.org1.example.com:7051"],"policies":{"Readers":"OR('Org1MSP.admin', 'Org1MSP.peer')"}},` +
+		`{"name":"Org2MSP","msp_id":"Org2MSP","anchor_peers":["peer0.org2.example.com:7051"],"policies":{"Readers":"OR('Org2MSP.admin', 'Org2MSP.peer')"}}],` +
+		`"orderer_orgs":[{"name":"OrdererOrg","msp_id":"OrdererMSP","endpoints":["orderer.example.com:7050"]}],` +
+		`"orderer_addresses":["orderer.example.com:7050"],"consensus_type":"etcdraft",` +
+		`"batch_size":{"max_message_count":10,"absolute_max_bytes":103809024,"preferred_max_bytes":524288},"batch_timeout":"2s",` +
+		`"capabilities":{"Application":["V1_4_2","V2_0"],"Channel":["V2_0"]},` +
+		`"policies":{"/Channel/Admins":"MAJORITY Admins",` +
+		`"/Channel/Application/Org1MSP/Readers":"OR('Org1MSP.admin', 'Org1MSP.peer')",` +
+		`"/Channel/Application/Org2MSP/Readers":"OR('Org2MSP.admin', 'Org2MSP.peer')",` +
+		`"/Channel/Readers":"ANY Readers"}}`
+	if string(buf) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf)
+	}
+
+	// 没有channel group时返回空配置
+	empty, err := convertChannelConfig(&common.Config{Sequence: 1})
+	if err != nil || empty.Sequence != 1 || len(empty.Orgs) != 0 {
+		t.Errorf("unexpected empty config %+v %v", empty, err)
+	}
+	// 已知的值无法解析时返回错误
+	broken := &common.Config{ChannelGroup: &common.ConfigGroup{Values: map[string]*common.ConfigValue{valueOrdererAddresses: {Value: []byte{0xff}}}}}
+	if _, err := convertChannelConfig(broken); err == nil {
+		t.Error("expected an invalid OrdererAddresses to be rejected")
+	}
+}
+
+func TestRenderSignatureRule(t *testing.T) {
+	principals := []string{"'Org1MSP.member'", "'Org2MSP.member'", "'Org3MSP.admin'"}
+	tests := []struct {
+		rule     *common.SignaturePolicy
+		expected string
+	}{
+		{nil, ""},
+		{signedBy(0), "'Org1MSP.member'"},
+		{nOutOf(1, signedBy(0), signedBy(1)), "OR('Org1MSP.member', 'Org2MSP.member')"},
+		{nOutOf(2, signedBy(0), signedBy(1)), "AND('Org1MSP.member', 'Org2MSP.member')"},
+		{nOutOf(2, signedBy(0), signedBy(1), signedBy(2)), "OutOf(2, 'Org1MSP.member', 'Org2MSP.member', 'Org3MSP.admin')"},
+		{nOutOf(1, signedBy(0)), "OutOf(1, 'Org1MSP.member')"},
+		{nOutOf(2, signedBy(2), nOutOf(1, signedBy(0), signedBy(1))), "AND('Org3MSP.admin', OR('Org1MSP.member', 'Org2MSP.member'))"},
+		{signedBy(3), "'<unknown principal 3>'"},
+		{signedBy(-1), "'<unknown principal -1>'"},
+	}
+
+	for _, test := range tests {
+		if rendered := renderSignatureRule(test.rule, principals); rendered != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, rendered)
+		}
+	}
+
+	ou := &mspproto.MSPPrincipal{
+		PrincipalClassification: mspproto.MSPPrincipal_ORGANIZATION_UNIT,
+		Principal:               mustMarshal(t, &mspproto.OrganizationUnit{MspIdentifier: "Org1MSP", OrganizationalUnitIdentifier: "client"}),
+	}
+	policy := testSignaturePolicy(t, nOutOf(1, signedBy(0), signedBy(1)), testRolePrincipal(t, "Org1MSP", mspproto.MSPRole_CLIENT), ou)
+	if rendered := renderPolicy(policy.Policy); rendered != "OR('Org1MSP.client', 'Org1MSP.OU:client')" {
+		t.Errorf("unexpected policy %s", rendered)
+	}
+}
+
+func TestDecodeConfigValue(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    []byte
+		expected string
+	}{
+		{valueMSP, testMSPValue(t, "Org1MSP").Value, `{"msp_id":"Org1MSP"}`},
+		{valueAnchorPeers, mustMarshal(t, &peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: "peer0.org1.example.com", Port: 7051}}}), `["peer0.org1.example.com:7051"]`},
+		{valueOrdererAddresses, mustMarshal(t, &common.OrdererAddresses{Addresses: []string{"orderer.example.com:7050"}}), `{"addresses":["orderer.example.com:7050"]}`},
+		{valueBatchSize, mustMarshal(t, &orderer.BatchSize{MaxMessageCount: 10}), `{"max_message_count":10}`},
+		{valueConsensusType, mustMarshal(t, &orderer.ConsensusType{Type: "etcdraft"}), `{"state":"STATE_NORMAL","type":"etcdraft"}`},
+		{valueCapabilities, testCapabilities(t, "V2_0", "V1_4_2").Value, `["V1_4_2","V2_0"]`},
+		{valueACLs, mustMarshal(t, &peer.ACLs{Acls: map[string]*peer.APIResource{"qscc/GetBlockByNumber": {PolicyRef: "/Channel/Application/Readers"}}}), `{"qscc/GetBlockByNumber":"/Channel/Application/Readers"}`},
+		// 未知的key及无法解析的值以base64返回
+		{"CustomValue", []byte{0x01, 0x02}, `"AQI="`},
+		{valueAnchorPeers, []byte{0xff}, `"/w=="`},
+		// read set中的值为空
+		{valueMSP, nil, `null`},
+	}
+
+	for _, test := range tests {
+		buf, err := json.Marshal(decodeConfigValue(test.key, test.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.key, test.expected, buf)
+		}
+	}
+}
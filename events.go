@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// event names of the server-sent events
+const (
+	StreamEventBlock         = "block"
+	StreamEventFilteredBlock = "filtered-block"
+	StreamEventChaincode     = "chaincode"
+	StreamEventError         = "error"
+)
+
+// streamKeepAlive 无事件时调用idle的间隔
+const streamKeepAlive = 15 * time.Second
+
+// streamsClosing 服务退出时关闭，结束所有事件流，避免阻塞graceful shutdown
+var streamsClosing = make(chan struct{})
+
+// errStreamClosing 服务退出时结束事件流
+var errStreamClosing = errors.New("event stream closing")
+
+// streamStopped ctx结束时返回ctx.Err()，服务退出时返回errStreamClosing，否则返回nil
+func streamStopped(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-streamsClosing:
+		return errStreamClosing
+	default:
+		return nil
+	}
+}
+
+// FilteredTransaction is a transaction of a filtered block, chaincode events carry no payload
+type FilteredTransaction struct {
+	TxID             string     `json:"tx_id"`
+	Type             string     `json:"type"`
+	ValidationResult string     `json:"validation_result"`
+	Events           []*CCEvent `json:"events,omitempty"`
+}
+
+// FilteredBlockDetail is a block reduced to its transaction ids, validation results and events
+type FilteredBlockDetail struct {
+	ChannelName  string                 `json:"channel_name"`
+	Number       uint64                 `json:"number"`
+	Transactions []*FilteredTransaction `json:"transactions"`
+}
+
+// ChaincodeEventDetail is a chaincode event of a valid transaction
+type ChaincodeEventDetail struct {
+	*CCEvent
+	BlockNumber uint64 `json:"block_number"`
+}
+
+// resumeToken 事件id，区块事件为区块号，chaincode事件为 区块号:txID:序号
+// 序号为事件在该交易匹配的事件中的位置，同一交易的多个事件id不同
+// 旧格式 区块号:txID 没有序号，index为-1，表示该交易的事件均已推送
+type resumeToken struct {
+	block uint64
+	txID  string
+	index int
+}
+
+func parseResumeToken(token string) (*resumeToken, error) {
+	parts := strings.SplitN(token, ":", 3)
+	block, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resume token %s", token)
+	}
+	rt := &resumeToken{block: block, index: -1}
+	if len(parts) >= 2 {
+		if parts[1] == "" {
+			return nil, fmt.Errorf("invalid resume token %s", token)
+		}
+		rt.txID = parts[1]
+	}
+	if len(parts) == 3 {
+		if rt.index, err = strconv.Atoi(parts[2]); err != nil || rt.index < 0 {
+			return nil, fmt.Errorf("invalid resume token %s", token)
+		}
+	}
+	return rt, nil
+}
+
+// delivered 区块block中交易txID的第index个事件是否已在token之前推送
+func (t *resumeToken) delivered(block uint64, txID string, index int) bool {
+	return t != nil && block == t.block && txID == t.txID && index <= t.index
+}
+
+// eventID 返回chaincode事件的id，格式与resumeToken一致
+func eventID(block uint64, txID string, index int) string {
+	return fmt.Sprintf("%d:%s:%d", block, txID, index)
+}
+
+// blockStream 历史区块通过ledger补发，之后推送实时事件，实时区块不连续时同样通过ledger补齐
+// seek参数不参与sdk事件服务的缓存key，因此不使用event.WithSeekType回放
+type blockStream struct {
+	peer         string
+	ledgerClient *ledger.Client
+	eventClient  *event.Client
+	next         uint64
+}
+
+// streamHandlers 处理补发及实时推送的内容，block处理通过ledger补发的区块，不能为空
+// filteredBlock或chaincode不为空时注册对应的实时事件，由sdk完成过滤，否则实时区块同样交给block处理
+// chaincode只接收chaincodeID设置的、名称匹配eventFilter的事件，idle不为空时在无事件期间定期调用
+type streamHandlers struct {
+	block         func(*cb.Block) error
+	filteredBlock func(*peer.FilteredBlock) error
+	chaincode     func(*fab.CCEvent) error
+	idle          func() error
+
+	chaincodeID string
+	eventFilter string
+}
+
+// openBlockStream 使用identity创建通道的ledger及事件客户端
+// blockEvents为false时事件客户端只能接收过滤区块，chaincode事件不含payload
+func openBlockStream(channelID, peer string, identity *FabricIdentity, blockEvents bool) (*blockStream, error) {
+	channelContext := sdk.ChannelContext(channelID, fabsdk.WithUser(identity.UserName), fabsdk.WithOrg(identity.OrgName))
+	ledgerClient, err := ledger.New(channelContext)
+	if err != nil {
+		return nil, err
+	}
+	var opts []event.ClientOption
+	if blockEvents {
+		opts = append(opts, event.WithBlockEvents())
+	}
+	eventClient, err := event.New(channelContext, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &blockStream{peer: peer, ledgerClient: ledgerClient, eventClient: eventClient}, nil
+}
+
+// newBlockStream 解析参数并创建客户端，失败时已写入响应
+func newBlockStream(ctx *gin.Context, req *EventStreamRequest, res *ACLResource, blockEvents bool) (*blockStream, *resumeToken, bool) {
+	if !authorize(ctx, res) {
+		return nil, nil, false
+	}
+	identity, err := resolveIdentity(ctx, "", "")
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if req.Peer == "" && len(serverConfig.TargetPeers) > 0 {
+		req.Peer = serverConfig.TargetPeers[0]
+	}
+
+	var token *resumeToken
+	if req.Resume == "" {
+		req.Resume = ctx.GetHeader("Last-Event-ID")
+	}
+	if req.Resume != "" {
+		if token, err = parseResumeToken(req.Resume); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, nil, false
+		}
+	}
+
+	stream, err := openBlockStream(req.ChannelID, req.Peer, identity, blockEvents)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	info, err := stream.ledgerClient.QueryInfo(ledger.WithTargetEndpoints(req.Peer))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	height := info.BCI.Height
+
+	switch {
+	case token != nil && token.txID != "":
+		// 该区块中token之后的事件尚未发送
+		stream.next = token.block
+	case token != nil:
+		stream.next = token.block + 1
+	case req.From == "" || req.From == "newest":
+		stream.next = height
+	case req.From == "oldest":
+		stream.next = 0
+	default:
+		if stream.next, err = strconv.ParseUint(req.From, 10, 64); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be a block number, oldest or newest"})
+			return nil, nil, false
+		}
+	}
+	if stream.next > height {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("block %d is beyond the ledger height %d", stream.next, height)})
+		return nil, nil, false
+	}
+	return stream, token, true
+}
+
+// run 补发历史区块后推送实时事件，ctx结束或服务退出时返回nil
+func (s *blockStream) run(ctx context.Context, handlers *streamHandlers) error {
+	// 先注册实时事件再补发历史区块，补发期间提交的区块不会遗漏
+	var (
+		reg            fab.Registration
+		blocks         <-chan *fab.BlockEvent
+		filteredBlocks <-chan *fab.FilteredBlockEvent
+		ccEvents       <-chan *fab.CCEvent
+		err            error
+	)
+	switch {
+	case handlers.chaincode != nil:
+		reg, ccEvents, err = s.eventClient.RegisterChaincodeEvent(handlers.chaincodeID, handlers.eventFilter)
+	case handlers.filteredBlock != nil:
+		reg, filteredBlocks, err = s.eventClient.RegisterFilteredBlockEvent()
+	default:
+		reg, blocks, err = s.eventClient.RegisterBlockEvent()
+	}
+	if err != nil {
+		return err
+	}
+	defer s.eventClient.Unregister(reg)
+
+	// 补发期间实时事件在缓冲区中等待，缓冲区满时sdk会丢弃事件，因此补发到账本高度不再增长为止
+	for {
+		info, err := s.ledgerClient.QueryInfo(ledger.WithTargetEndpoints(s.peer))
+		if err != nil {
+			return err
+		}
+		if info.BCI.Height <= s.next {
+			break
+		}
+		if err := s.replay(ctx, info.BCI.Height, handlers.block); err != nil {
+			return ignoreStopped(ctx, err)
+		}
+	}
+	// chaincode事件只在区块包含匹配的事件时推送，无法判断是否有事件被丢弃，因此不补齐
+	replayed := s.next
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-streamsClosing:
+			return nil
+		case <-keepAlive.C:
+			if handlers.idle == nil {
+				continue
+			}
+			if err := handlers.idle(); err != nil {
+				return nil
+			}
+		case blockEvent, ok := <-blocks:
+			if !ok {
+				return errors.New("block event stream closed")
+			}
+			block := blockEvent.Block
+			err = s.handleLive(ctx, block.GetHeader().GetNumber(), handlers.block, func() error { return handlers.block(block) })
+		case filteredEvent, ok := <-filteredBlocks:
+			if !ok {
+				return errors.New("filtered block event stream closed")
+			}
+			block := filteredEvent.FilteredBlock
+			err = s.handleLive(ctx, block.GetNumber(), handlers.block, func() error { return handlers.filteredBlock(block) })
+		case ccEvent, ok := <-ccEvents:
+			if !ok {
+				return errors.New("chaincode event stream closed")
+			}
+			// 同一区块可能有多个事件，只跳过已补发的区块
+			if ccEvent.BlockNumber < replayed {
+				continue
+			}
+			err = handlers.chaincode(ccEvent)
+		}
+		if err != nil {
+			return ignoreStopped(ctx, err)
+		}
+	}
+}
+
+// handleLive 先通过ledger补齐s.next与实时区块number之间丢弃的区块，再处理实时区块，已处理的区块跳过
+func (s *blockStream) handleLive(ctx context.Context, number uint64, replay func(*cb.Block) error, handle func() error) error {
+	if number < s.next {
+		return nil
+	}
+	// 补发中途停止时不能再处理实时区块，否则之后的checkpoint会越过未补发的区块
+	if err := s.replay(ctx, number, replay); err != nil {
+		return err
+	}
+	if err := handle(); err != nil {
+		return err
+	}
+	s.next = number + 1
+	return nil
+}
+
+// ignoreStopped ctx结束或服务退出导致的错误视为正常结束
+func ignoreStopped(ctx context.Context, err error) error {
+	if err == errStreamClosing || err == ctx.Err() {
+		return nil
+	}
+	return err
+}
+
+// replay 通过ledger补发[s.next, end)之间的区块，ctx结束或服务退出时返回streamStopped的错误
+func (s *blockStream) replay(ctx context.Context, end uint64, handle func(*cb.Block) error) error {
+	for ; s.next < end; s.next++ {
+		if err := streamStopped(ctx); err != nil {
+			return err
+		}
+		block, err := QueryBlockByNum(s.ledgerClient, s.next, s.peer)
+		if err != nil {
+			return err
+		}
+		if err := handle(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// start 写入SSE响应头后开始推送，出错时推送error事件并结束
+func (s *blockStream) start(ctx *gin.Context, handlers *streamHandlers) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	// 定期发送注释，防止代理断开空闲连接
+	handlers.idle = func() error {
+		if _, err := ctx.Writer.WriteString(": keepalive\n\n"); err != nil {
+			return err
+		}
+		ctx.Writer.Flush()
+		return nil
+	}
+	if err := s.run(ctx.Request.Context(), handlers); err != nil {
+		log.Println("the event stream err info is : ", err.Error())
+		sendEvent(ctx, "", StreamEventError, gin.H{"error": err.Error()})
+	}
+}
+
+func sendEvent(ctx *gin.Context, id, name string, data interface{}) {
+	ctx.Render(-1, sse.Event{Id: id, Event: name, Data: data})
+	ctx.Writer.Flush()
+}
+
+// streamBlocks 处理 /events/blocks，推送解析后的完整区块
+func streamBlocks(ctx *gin.Context) {
+	req := new(EventStreamRequest)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stream, _, ok := newBlockStream(ctx, req, &ACLResource{ChannelID: req.ChannelID}, true)
+	if !ok {
+		return
+	}
+
+	opts := &TxDetailOptions{RWSet: req.RWSet}
+	stream.start(ctx, &streamHandlers{
+		block: func(block *cb.Block) error {
+			detail, err := convertBlockToDetail(req.ChannelID, block, opts)
+			if err != nil {
+				return err
+			}
+			sendEvent(ctx, strconv.FormatUint(detail.Number, 10), StreamEventBlock, detail)
+			return nil
+		},
+	})
+}
+
+// streamFilteredBlocks 处理 /events/filtered-blocks，只推送交易id、校验结果及不含payload的chaincode事件
+// 实时区块使用peer的过滤区块事件，补发的区块由完整区块转换
+func streamFilteredBlocks(ctx *gin.Context) {
+	req := new(EventStreamRequest)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stream, _, ok := newBlockStream(ctx, req, &ACLResource{ChannelID: req.ChannelID}, false)
+	if !ok {
+		return
+	}
+
+	stream.start(ctx, &streamHandlers{
+		block: func(block *cb.Block) error {
+			detail, err := convertBlockToDetail(req.ChannelID, block, &TxDetailOptions{})
+			if err != nil {
+				return err
+			}
+			sendEvent(ctx, strconv.FormatUint(detail.Number, 10), StreamEventFilteredBlock, filterBlockDetail(detail))
+			return nil
+		},
+		filteredBlock: func(block *peer.FilteredBlock) error {
+			sendEvent(ctx, strconv.FormatUint(block.Number, 10), StreamEventFilteredBlock, convertFilteredBlock(req.ChannelID, block))
+			return nil
+		},
+	})
+}
+
+func filterBlockDetail(detail *BlockDetail) *FilteredBlockDetail {
+	filtered := &FilteredBlockDetail{
+		ChannelName:  detail.ChannelName,
+		Number:       detail.Number,
+		Transactions: make([]*FilteredTransaction, 0, len(detail.Transactions)),
+	}
+	for _, tx := range detail.Transactions {
+		ftx := &FilteredTransaction{TxID: tx.ID, Type: tx.Type, ValidationResult: tx.ValidationResult}
+		for _, action := range tx.Actions {
+			if action.Event != nil {
+				ftx.Events = append(ftx.Events, &CCEvent{
+					ChaincodeID: action.Event.ChaincodeID,
+					TxID:        action.Event.TxID,
+					EventName:   action.Event.EventName,
+				})
+			}
+		}
+		filtered.Transactions = append(filtered.Transactions, ftx)
+	}
+	return filtered
+}
+
+// convertFilteredBlock 将peer推送的过滤区块转换为与filterBlockDetail相同的格式
+func convertFilteredBlock(channelID string, block *peer.FilteredBlock) *FilteredBlockDetail {
+	filtered := &FilteredBlockDetail{
+		ChannelName:  channelID,
+		Number:       block.Number,
+		Transactions: make([]*FilteredTransaction, 0, len(block.FilteredTransactions)),
+	}
+	for _, tx := range block.FilteredTransactions {
+		ftx := &FilteredTransaction{TxID: tx.Txid, Type: tx.Type.String(), ValidationResult: tx.TxValidationCode.String()}
+		for _, action := range tx.GetTransactionActions().GetChaincodeActions() {
+			if ccEvent := action.GetChaincodeEvent(); ccEvent != nil {
+				ftx.Events = append(ftx.Events, &CCEvent{
+					ChaincodeID: ccEvent.ChaincodeId,
+					TxID:        ccEvent.TxId,
+					EventName:   ccEvent.EventName,
+				})
+			}
+		}
+		filtered.Transactions = append(filtered.Transactions, ftx)
+	}
+	return filtered
+}
+
+// compileEventFilter 需完整匹配事件名，为空时匹配所有事件
+// sdk的RegisterChaincodeEvent不会添加^$，注册时使用返回的正则表达式字符串
+func compileEventFilter(event string) (*regexp.Regexp, error) {
+	if event == "" {
+		event = ".*"
+	}
+	return regexp.Compile("^(?:" + event + ")$")
+}
+
+// pendingTransactions 返回区块中尚未处理完的交易，从resume token所在区块续传时跳过token之前的交易
+// token带序号时保留token所在的交易，其中已推送的事件由resumeToken.delivered判断
+func pendingTransactions(detail *BlockDetail, token *resumeToken) []*TransactionDetail {
+	if token == nil || token.txID == "" || detail.Number != token.block {
+		return detail.Transactions
+	}
+	for i, tx := range detail.Transactions {
+		if tx.ID == token.txID {
+			if token.index >= 0 {
+				return detail.Transactions[i:]
+			}
+			return detail.Transactions[i+1:]
+		}
+	}
+	return nil
+}
+
+// chaincodeEvents 返回有效交易中ccID设置的、名称匹配filter的事件
+func chaincodeEvents(tx *TransactionDetail, ccID string, filter *regexp.Regexp) []*CCEvent {
+	if tx.ValidationResult != peer.TxValidationCode_VALID.String() {
+		return nil
+	}
+	var events []*CCEvent
+	for _, action := range tx.Actions {
+		ccEvent := action.Event
+		if ccEvent != nil && ccEvent.ChaincodeID == ccID && filter.MatchString(ccEvent.EventName) {
+			events = append(events, ccEvent)
+		}
+	}
+	return events
+}
+
+// streamChaincodeEvents 处理 /events/chaincode，推送有效交易中ccID设置的、名称匹配event的事件
+// 实时事件由sdk过滤，保留payload
+func streamChaincodeEvents(ctx *gin.Context) {
+	req := new(EventStreamRequest)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ChaincodeID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ccID is required"})
+		return
+	}
+	eventFilter, err := compileEventFilter(req.Event)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid event: " + err.Error()})
+		return
+	}
+
+	stream, token, ok := newBlockStream(ctx, req, &ACLResource{ChannelID: req.ChannelID, ChaincodeID: req.ChaincodeID}, true)
+	if !ok {
+		return
+	}
+
+	send := func(blockNumber uint64, index int, ccEvent *CCEvent) {
+		sendEvent(ctx, eventID(blockNumber, ccEvent.TxID, index), StreamEventChaincode, &ChaincodeEventDetail{CCEvent: ccEvent, BlockNumber: blockNumber})
+	}
+	// 实时事件按交易依次推送，同一交易的事件连续到达
+	var last *fab.CCEvent
+	index := 0
+	stream.start(ctx, &streamHandlers{
+		block: func(block *cb.Block) error {
+			detail, err := convertBlockToDetail(req.ChannelID, block, &TxDetailOptions{})
+			if err != nil {
+				return err
+			}
+			for _, tx := range pendingTransactions(detail, token) {
+				for i, ccEvent := range chaincodeEvents(tx, req.ChaincodeID, eventFilter) {
+					if !token.delivered(detail.Number, tx.ID, i) {
+						send(detail.Number, i, ccEvent)
+					}
+				}
+			}
+			return nil
+		},
+		chaincode: func(ccEvent *fab.CCEvent) error {
+			if last != nil && last.BlockNumber == ccEvent.BlockNumber && last.TxID == ccEvent.TxID {
+				index++
+			} else {
+				index = 0
+			}
+			last = ccEvent
+			send(ccEvent.BlockNumber, index, &CCEvent{
+				ChaincodeID: ccEvent.ChaincodeID,
+				TxID:        ccEvent.TxID,
+				EventName:   ccEvent.EventName,
+				Payload:     renderValue(ccEvent.Payload),
+			})
+			return nil
+		},
+		chaincodeID: req.ChaincodeID,
+		eventFilter: eventFilter.String(),
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestParseResumeToken(t *testing.T) {
+	tests := []struct {
+		token string
+		// 为nil表示无效
+		expected *resumeToken
+	}{
+		{"12", &resumeToken{block: 12, index: -1}},
+		{"12:tx1", &resumeToken{block: 12, txID: "tx1", index: -1}},
+		{"12:tx1:0", &resumeToken{block: 12, txID: "tx1", index: 0}},
+		{"12:tx1:3", &resumeToken{block: 12, txID: "tx1", index: 3}},
+		{"", nil},
+		{"-1", nil},
+		{"abc", nil},
+		{"12:", nil},
+		{"12::0", nil},
+		{"12:tx1:", nil},
+		{"12:tx1:-1", nil},
+		{"12:tx1:x", nil},
+		{"12:tx1:0:1", nil},
+	}
+
+	for _, test := range tests {
+		token, err := parseResumeToken(test.token)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %+v", test.token, token)
+			}
+			continue
+		}
+		if err != nil || *token != *test.expected {
+			t.Errorf("%q: expected %+v, got %+v %v", test.token, test.expected, token, err)
+		}
+	}
+}
+
+// TestResumeChaincodeEvents 从事件id续传时，同一交易中之后的事件不会被跳过
+func TestResumeChaincodeEvents(t *testing.T) {
+	valid := peer.TxValidationCode_VALID.String()
+	event := func(txID, name string) *ActionDetail {
+		return &ActionDetail{Event: &CCEvent{ChaincodeID: "fabcar", TxID: txID, EventName: name}}
+	}
+	detail := &BlockDetail{
+		Number: 5,
+		Transactions: []*TransactionDetail{
+			{ID: "tx1", ValidationResult: valid, Actions: []*ActionDetail{event("tx1", "a"), event("tx1", "b")}},
+			{ID: "tx2", ValidationResult: peer.TxValidationCode_MVCC_READ_CONFLICT.String(), Actions: []*ActionDetail{event("tx2", "a")}},
+			{ID: "tx3", ValidationResult: valid, Actions: []*ActionDetail{event("tx3", "a"), event("tx3", "other"), event("tx3", "b")}},
+		},
+	}
+	filter, err := compileEventFilter("a|b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		resume string
+		ids    []string
+	}{
+		{"", []string{"5:tx1:0", "5:tx1:1", "5:tx3:0", "5:tx3:1"}},
+		{"4", []string{"5:tx1:0", "5:tx1:1", "5:tx3:0", "5:tx3:1"}},
+		{"5:tx1:0", []string{"5:tx1:1", "5:tx3:0", "5:tx3:1"}},
+		{"5:tx1:1", []string{"5:tx3:0", "5:tx3:1"}},
+		{"5:tx3:0", []string{"5:tx3:1"}},
+		// 没有序号时该交易的事件均已推送
+		{"5:tx1", []string{"5:tx3:0", "5:tx3:1"}},
+		{"5:tx3", nil},
+		{"5:unknown:0", nil},
+	}
+
+	for _, test := range tests {
+		var token *resumeToken
+		if test.resume != "" {
+			if token, err = parseResumeToken(test.resume); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var ids []string
+		for _, tx := range pendingTransactions(detail, token) {
+			for i, ccEvent := range chaincodeEvents(tx, "fabcar", filter) {
+				if !token.delivered(detail.Number, tx.ID, i) {
+					ids = append(ids, eventID(detail.Number, ccEvent.TxID, i))
+				}
+			}
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(test.ids) {
+			t.Errorf("resume %q: expected %v, got %v", test.resume, test.ids, ids)
+		}
+	}
+}
+
+func TestConvertFilteredBlock(t *testing.T) {
+	block := &peer.FilteredBlock{
+		ChannelId: "mychannel",
+		Number:    7,
+		FilteredTransactions: []*peer.FilteredTransaction{
+			{
+				Txid:             "tx1",
+				Type:             cb.HeaderType_ENDORSER_TRANSACTION,
+				TxValidationCode: peer.TxValidationCode_VALID,
+				Data: &peer.FilteredTransaction_TransactionActions{TransactionActions: &peer.FilteredTransactionActions{
+					ChaincodeActions: []*peer.FilteredChaincodeAction{
+						{ChaincodeEvent: &peer.ChaincodeEvent{ChaincodeId: "fabcar", TxId: "tx1", EventName: "a"}},
+						{},
+					},
+				}},
+			},
+			{Txid: "tx2", Type: cb.HeaderType_ENDORSER_TRANSACTION, TxValidationCode: peer.TxValidationCode_MVCC_READ_CONFLICT},
+		},
+	}
+
+	filtered := convertFilteredBlock("mychannel", block)
+	if filtered.ChannelName != "mychannel" || filtered.Number != 7 || len(filtered.Transactions) != 2 {
+		t.Fatalf("unexpected block %+v", filtered)
+	}
+	tx1, tx2 := filtered.Transactions[0], filtered.Transactions[1]
+	if tx1.TxID != "tx1" || tx1.Type != "ENDORSER_TRANSACTION" || tx1.ValidationResult != "VALID" || len(tx1.Events) != 1 || *tx1.Events[0] != (CCEvent{ChaincodeID: "fabcar", TxID: "tx1", EventName: "a"}) {
+		t.Errorf("unexpected transaction %+v", tx1)
+	}
+	if tx2.ValidationResult != "MVCC_READ_CONFLICT" || tx2.Events != nil {
+		t.Errorf("unexpected transaction %+v", tx2)
+	}
+}
@@ -6,9 +6,11 @@ require (
 	github.com/Shopify/sarama v1.27.2 // indirect
 	github.com/ewagmig/fabric v1.4.4-0.20200828030817-34d44ec96999
 	github.com/fsouza/go-dockerclient v1.7.0 // indirect
+	github.com/gin-contrib/sse v0.1.0
 	github.com/gin-gonic/gin v1.6.3
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/golang/protobuf v1.4.3
-	github.com/hashicorp/go-version v1.2.1 // indirect
+	github.com/hashicorp/go-version v1.2.1
 	github.com/hyperledger/fabric v1.4.3 // indirect
 	github.com/hyperledger/fabric-amcl v0.0.0-20200424173818-327c9e2cf77a // indirect
 	github.com/hyperledger/fabric-protos-go v0.0.0-20201028172056-a3136dde2354
@@ -16,5 +18,6 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/sykesm/zap-logfmt v0.0.4 // indirect
 	go.uber.org/zap v1.16.0 // indirect
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
 	gopkg.in/yaml.v2 v2.4.0
 )
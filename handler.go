@@ -1,86 +1,496 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	mspclient "github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 )
 
 func hello(ctx *gin.Context) {
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"response": string("hello")})
 }
 
-func parseParameters(ctx *gin.Context) {
-	request = new(Parameters)
+// parseParameters 解析请求参数，每个请求独立一份，解析失败时已写入响应，调用方需直接返回
+func parseParameters(ctx *gin.Context) (*Parameters, bool) {
+	request := new(Parameters)
 	if err := ctx.ShouldBindJSON(request); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return nil, false
 	}
+	if err := validResponseFormat(request.ResponseFormat); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	// transient的值不会打印，见TransientMap
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, false
 	}
 	log.Println("the received  Requestcategory--body is : ", string(requestBytes))
+	return request, true
+}
+
+func newResMgmtClient() (*resmgmt.Client, error) {
+	clientContext := sdk.Context(fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
+	return resmgmt.New(clientContext)
+}
+
+// readChannelTx 读取通道交易，优先使用上传的文件，否则使用base64编码的channelTx
+func readChannelTx(ctx *gin.Context, req *CreateChannelRequest) ([]byte, error) {
+	if file, err := ctx.FormFile("txFile"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	}
+
+	if req.ChannelTx == "" {
+		return nil, errors.New("channel transaction is required, upload txFile or set channelTx")
+	}
+	return base64.StdEncoding.DecodeString(req.ChannelTx)
+}
+
+// getSigningIdentities 获取配置中各org的签名身份
+func getSigningIdentities() ([]msp.SigningIdentity, error) {
+	orgs := serverConfig.SignOrgs
+	if len(orgs) == 0 {
+		orgs = []string{serverConfig.OrgName}
+	}
+
+	identities := make([]msp.SigningIdentity, 0, len(orgs))
+	for _, org := range orgs {
+		mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(org))
+		if err != nil {
+			return nil, err
+		}
+		identity, err := mspClient.GetSigningIdentity(serverConfig.UserName)
+		if err != nil {
+			return nil, fmt.Errorf("get signing identity of %s@%s failed: %v", serverConfig.UserName, org, err)
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
 }
 
 func createChannel(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	req := new(CreateChannelRequest)
+	if err := ctx.ShouldBind(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID}) {
+		return
+	}
+
+	chTx, err := readChannelTx(ctx, req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resMgmtClient, err := newResMgmtClient()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	signIdentities, err := getSigningIdentities()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	txID, exists, err := CreateChannel(req.ChannelID, bytes.NewReader(chTx), serverConfig.TargetOrderer, signIdentities, resMgmtClient)
+	if err != nil {
+		log.Println("the createChannel response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : ", req.ChannelID, "====", txID, "===", exists)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "TxId": txID, "exists": exists})
 }
 
 func joinChannel(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	req := new(JoinChannelRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID}) {
+		return
+	}
+	if len(req.TargetPeers) == 0 {
+		req.TargetPeers = serverConfig.TargetPeers
+	}
+
+	resMgmtClient, err := newResMgmtClient()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := JoinChannel(req.ChannelID, serverConfig.TargetOrderer, req.TargetPeers, resMgmtClient)
+
+	status := http.StatusOK
+	for peer, result := range results {
+		log.Println("the joinChannel result is : ", peer, "====", result.Status, "===", result.Error)
+		if result.Status == PeerStatusFailed {
+			status = http.StatusMultiStatus
+		}
+	}
+	ctx.JSON(status, gin.H{"status": status, "response": results})
 }
 
 func queryChannel(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	req := new(QueryChannelRequest)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID}) {
+		return
+	}
+	targetPeers := serverConfig.TargetPeers
+	if req.Peer != "" {
+		targetPeers = []string{req.Peer}
+	}
+
+	resMgmtClient, err := newResMgmtClient()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ledgerClient *ledger.Client
+	if req.ChannelID != "" {
+		channelContext := sdk.ChannelContext(req.ChannelID, fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
+		ledgerClient, err = ledger.New(channelContext)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	infos := make(map[string]*PeerChannelInfo, len(targetPeers))
+	heights := make(map[uint64]bool)
+	for _, target := range targetPeers {
+		info := &PeerChannelInfo{}
+		infos[target] = info
+
+		info.Channels, err = QueryJoinedChannels(resMgmtClient, target)
+		if err != nil {
+			info.Error = err.Error()
+			continue
+		}
+		if ledgerClient == nil {
+			continue
+		}
+
+		for _, ch := range info.Channels {
+			if ch == req.ChannelID {
+				info.Joined = true
+				break
+			}
+		}
+		if !info.Joined {
+			continue
+		}
+		info.Ledger, err = QueryLedgerInfo(ledgerClient, target)
+		if err != nil {
+			info.Error = err.Error()
+			continue
+		}
+		heights[info.Ledger.Height] = true
+	}
+
+	response := gin.H{"status": http.StatusOK, "response": infos}
+	if ledgerClient != nil {
+		response["heightsAgree"] = len(heights) <= 1
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// readCCPackage 读取上传的chaincode包(tar.gz)，未上传时返回nil
+func readCCPackage(ctx *gin.Context) (*resource.CCPackage, error) {
+	file, err := ctx.FormFile("ccPackage")
+	if err != nil {
+		return nil, nil
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	code, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &resource.CCPackage{Type: pb.ChaincodeSpec_GOLANG, Code: code}, nil
+}
+
+// succeededPeers 返回结果中操作成功的peer
+func succeededPeers(results map[string]*PeerResult) []string {
+	peers := make([]string, 0, len(results))
+	for peer, result := range results {
+		if result.Status != PeerStatusFailed {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers
 }
 
 func createCC(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	req := new(CreateCCRequest)
+	if err := ctx.ShouldBind(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID, ChaincodeID: req.ChaincodeID}) {
+		return
+	}
+	if len(req.TargetPeers) == 0 {
+		req.TargetPeers = serverConfig.TargetPeers
+	}
+	// 需从第一个peer查询已实例化的版本
+	if len(req.TargetPeers) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "targetPeers is required when no target peers are configured"})
+		return
+	}
+
+	policy, err := ParsePolicy(req.Policy)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collConfig, err := ParseCollectionConfig(req.CollectionConfig)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ccPkg, err := readCCPackage(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resMgmtClient, err := newResMgmtClient()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 已实例化任意版本时需通过 /cc/update 升级，否则会绕过升级的版本检查及acl
+	instantiatedVersion, err := QueryInstantiatedVersion(resMgmtClient, req.ChannelID, req.ChaincodeID, req.TargetPeers[0])
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if instantiatedVersion != "" {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("chaincode %s:%s is already instantiated on channel %s, use /cc/update", req.ChaincodeID, instantiatedVersion, req.ChannelID)})
+		return
+	}
+
+	installResults := InstallCC(req.ChaincodeID, req.Version, req.Path, ccPkg, req.TargetPeers, resMgmtClient)
+	for peer, result := range installResults {
+		log.Println("the installCC result is : ", peer, "====", result.Status, "===", result.Error)
+	}
+
+	installedPeers := succeededPeers(installResults)
+	if len(installedPeers) == 0 {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "chaincode is not installed on any target peer", "install": installResults})
+		return
+	}
+
+	args := make([][]byte, 0)
+	for _, arg := range req.Args {
+		args = append(args, []byte(arg))
+	}
+
+	txID, err := InstantiateCC(req.ChannelID, req.ChaincodeID, req.Version, req.Path, args, policy, collConfig, installedPeers, resMgmtClient, false)
+	if err != nil {
+		log.Println("the instantiateCC response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "install": installResults})
+		return
+	}
+
+	if txID == "" {
+		// 检查之后被其他请求实例化
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("chaincode %s:%s is already instantiated on channel %s", req.ChaincodeID, req.Version, req.ChannelID), "install": installResults})
+		return
+	}
+
+	log.Println("the response is : ", req.ChaincodeID, "====", req.Version, "===", txID)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "install": installResults, "TxId": txID})
 }
 
 func updateCC(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	req := new(UpdateCCRequest)
+	if err := ctx.ShouldBind(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID, ChaincodeID: req.ChaincodeID}) {
+		return
+	}
+	if len(req.TargetPeers) == 0 {
+		req.TargetPeers = serverConfig.TargetPeers
+	}
+	// 需从第一个peer查询已实例化的版本
+	if len(req.TargetPeers) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "targetPeers is required when no target peers are configured"})
+		return
+	}
+
+	policy, err := ParsePolicy(req.Policy)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collConfig, err := ParseCollectionConfig(req.CollectionConfig)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ccPkg, err := readCCPackage(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resMgmtClient, err := newResMgmtClient()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 检查当前实例化的版本
+	oldVersion, err := QueryInstantiatedVersion(resMgmtClient, req.ChannelID, req.ChaincodeID, req.TargetPeers[0])
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if oldVersion == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("chaincode %s is not instantiated on channel %s", req.ChaincodeID, req.ChannelID)})
+		return
+	}
+	// 同一版本无法升级，force也不例外
+	if oldVersion == req.Version {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("chaincode %s:%s is already instantiated", req.ChaincodeID, req.Version)})
+		return
+	}
+	if !req.Force && IsDowngrade(oldVersion, req.Version) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("refuse to downgrade chaincode %s from %s to %s", req.ChaincodeID, oldVersion, req.Version)})
+		return
+	}
+
+	installResults := InstallCC(req.ChaincodeID, req.Version, req.Path, ccPkg, req.TargetPeers, resMgmtClient)
+	for peer, result := range installResults {
+		log.Println("the installCC result is : ", peer, "====", result.Status, "===", result.Error)
+	}
+
+	installedPeers := succeededPeers(installResults)
+	if len(installedPeers) == 0 {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "chaincode is not installed on any target peer", "install": installResults})
+		return
+	}
+
+	args := make([][]byte, 0)
+	for _, arg := range req.Args {
+		args = append(args, []byte(arg))
+	}
+
+	// InstantiateCC中根据InstantiateOrUpdate的结果决定是否upgrade
+	txID, err := InstantiateCC(req.ChannelID, req.ChaincodeID, req.Version, req.Path, args, policy, collConfig, installedPeers, resMgmtClient, true)
+	if err != nil {
+		log.Println("the upgradeCC response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "install": installResults})
+		return
+	}
+	if txID == "" {
+		// 检查之后被其他请求升级到了该版本，未执行任何操作
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("chaincode %s:%s is already instantiated", req.ChaincodeID, req.Version), "install": installResults})
+		return
+	}
+
+	log.Println("the response is : ", req.ChaincodeID, "====", oldVersion, "->", req.Version, "===", txID)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "install": installResults, "oldVersion": oldVersion, "newVersion": req.Version, "TxId": txID})
 }
 
 func invokeCC(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	request, ok := parseParameters(ctx)
+	if !ok {
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: request.ChannelID, ChaincodeID: request.ChaincodeID, Function: request.Function}) {
+		return
+	}
+	async, err := strconv.ParseBool(ctx.DefaultQuery("async", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid async: " + err.Error()})
+		return
+	}
+
+	identity, err := resolveIdentity(ctx, request.OrgName, request.UserName)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 
-	log.Println(request.ChannelID, serverConfig.OrgName, serverConfig.UserName)
+	log.Println(request.ChannelID, identity.OrgName, identity.UserName)
 
-	channelContext := sdk.ChannelContext(request.ChannelID, fabsdk.WithOrg(serverConfig.OrgName), fabsdk.WithUser(serverConfig.UserName))
+	channelContext := sdk.ChannelContext(request.ChannelID, fabsdk.WithOrg(identity.OrgName), fabsdk.WithUser(identity.UserName))
 	client, err := channel.New(channelContext)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	args := make([][]byte, 0)
-	for i, arg := range request.Args {
-		log.Println("the invokeCC request.Arg : ", i, arg)
-		args = append(args, []byte(arg))
+	req := newChannelRequest(request)
+	if async {
+		invokeCCAsync(ctx, client, req, request)
+		return
 	}
 
-	result, err := InvokeCC(client,
-		channel.Request{
-			ChaincodeID: request.ChaincodeID,
-			Fcn:         request.Function,
-			Args:        args,
-		},
-	)
+	result, err := InvokeCC(client, req)
 	if err != nil {
 		log.Println("the invokeCC response err info is : ", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -89,38 +499,80 @@ func invokeCC(ctx *gin.Context) {
 
 	// result.Responses[0].Response.Payload
 	status := result.Responses[0].Response.Status
-	response := result.Responses[0].Response.Payload
+	payload := result.Responses[0].Response.Payload
 	txid := result.TransactionID
 	valid := result.TxValidationCode
 
-	log.Println("the response is : ", txid, "====", valid, "===", string(response))
-	ctx.JSON(http.StatusOK, gin.H{"status": status, "TxId": txid, "Valid": valid, "response": string(response)})
+	log.Println("the response is : ", txid, "====", valid, "===", string(payload))
+	response, err := formatPayload(payload, request.ResponseFormat)
+	if err != nil {
+		// 交易已提交，仍返回txID
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "TxId": txid, "Valid": valid})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": status, "TxId": txid, "Valid": valid, "response": response})
+}
+
+// invokeCCAsync 背书完成后即返回202及txID，排序及提交在后台进行，进度通过 /jobs/:txID 查询
+func invokeCCAsync(ctx *gin.Context, client *channel.Client, req channel.Request, request *Parameters) {
+	handler := newTrackedCommitHandler(Job{
+		ChannelID:   request.ChannelID,
+		ChaincodeID: request.ChaincodeID,
+		Function:    request.Function,
+		User:        ctx.GetString(gin.AuthUserKey),
+	}, request.ResponseFormat)
+
+	done := make(chan error, 1)
+	jobs.pending.Add(1)
+	go func() {
+		defer jobs.pending.Done()
+		result, err := InvokeCCAsync(client, req, handler)
+		if err != nil {
+			log.Println("the invokeCC async response err info is : ", err.Error())
+		} else {
+			log.Println("the invokeCC async response is : ", result.TransactionID, "====", result.TxValidationCode)
+		}
+		done <- err
+	}()
+
+	select {
+	case txID := <-handler.endorsed:
+		ctx.JSON(http.StatusAccepted, gin.H{"status": http.StatusAccepted, "TxId": txID})
+	case err := <-done:
+		// 背书后很快失败时两个channel可能同时就绪
+		select {
+		case txID := <-handler.endorsed:
+			ctx.JSON(http.StatusAccepted, gin.H{"status": http.StatusAccepted, "TxId": txID})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
 }
 
 func queryCC(ctx *gin.Context) {
 	// 解析参数
-	parseParameters(ctx)
+	request, ok := parseParameters(ctx)
+	if !ok {
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: request.ChannelID, ChaincodeID: request.ChaincodeID, Function: request.Function}) {
+		return
+	}
 
-	channelContext := sdk.ChannelContext(request.ChannelID, fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
-	client, err := channel.New(channelContext)
+	identity, err := resolveIdentity(ctx, request.OrgName, request.UserName)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return
 	}
 
-	args := make([][]byte, 0)
-	for i, arg := range request.Args {
-		log.Println("the queryCC request.Arg : ", i, arg)
-		args = append(args, []byte(arg))
+	channelContext := sdk.ChannelContext(request.ChannelID, fabsdk.WithUser(identity.UserName), fabsdk.WithOrg(identity.OrgName))
+	client, err := channel.New(channelContext)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	result, err := QueryCC(client,
-		channel.Request{
-			ChaincodeID: request.ChaincodeID,
-			Fcn:         request.Function,
-			Args:        args,
-		},
-	)
+	result, err := QueryCC(client, newChannelRequest(request))
 	if err != nil {
 		log.Println("the queryCC response err info is : ", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -128,16 +580,27 @@ func queryCC(ctx *gin.Context) {
 	}
 
 	status := result.Responses[0].Response.Status
-	response := result.Responses[0].Response.Payload
+	payload := result.Responses[0].Response.Payload
 
-	log.Println("the response is : ", string(response))
-	ctx.JSON(http.StatusOK, gin.H{"status": status, "response": string(response)})
+	log.Println("the response is : ", string(payload))
+	response, err := formatPayload(payload, request.ResponseFormat)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": status, "response": response})
 }
 
 func queryTransactionByTxID(ctx *gin.Context) {
 	txID := ctx.Param("txID")
 
-	parseParameters(ctx)
+	request, ok := parseParameters(ctx)
+	if !ok {
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: request.ChannelID}) {
+		return
+	}
 
 	channelContext := sdk.ChannelContext(request.ChannelID, fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
 	ledgerClient, err := ledger.New(channelContext)
@@ -161,7 +624,20 @@ func queryTransactionByTxID(ctx *gin.Context) {
 		return
 	}
 
-	txD, err := convertEnvelopeToTXDetail(tx.ValidationCode, tx.GetTransactionEnvelope())
+	opts := &TxDetailOptions{
+		RWSet:  ctx.Query("rwset") == "true",
+		Verify: ctx.Query("verify") == "true",
+	}
+	// verifyCA=true 时同时校验证书是否由交易所在区块生效的通道配置中MSP的CA签发
+	if opts.Verify && ctx.Query("verifyCA") == "true" {
+		opts.MSPRoots, err = queryMSPRootsAt(ledgerClient, block, serverConfig.TargetPeers)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			log.Println(err.Error())
+			return
+		}
+	}
+	txD, err := convertEnvelopeToTXDetail(tx.ValidationCode, tx.GetTransactionEnvelope(), opts)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		log.Println(err.Error())
@@ -177,7 +653,284 @@ func queryTransactionByTxID(ctx *gin.Context) {
 		log.Println(err.Error())
 		return
 	}
-	
+
 	log.Println("the response is : ", string(txDBytes))
 	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": txD})
 }
+
+func queryBlockByNumber(ctx *gin.Context) {
+	number, err := strconv.ParseUint(ctx.Param("number"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queryBlock(ctx, func(ledgerClient *ledger.Client, target string) (*cb.Block, error) {
+		return QueryBlockByNum(ledgerClient, number, target)
+	})
+}
+
+// queryBlockByHash 处理 /block-by-hash/:hash
+func queryBlockByHash(ctx *gin.Context) {
+	hash, err := hex.DecodeString(ctx.Param("hash"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queryBlock(ctx, func(ledgerClient *ledger.Client, target string) (*cb.Block, error) {
+		return QueryBlockByHash(ledgerClient, hash, target)
+	})
+}
+
+func queryBlock(ctx *gin.Context, query func(*ledger.Client, string) (*cb.Block, error)) {
+	req := new(QueryBlockRequest)
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID}) {
+		return
+	}
+	if req.Peer == "" && len(serverConfig.TargetPeers) > 0 {
+		req.Peer = serverConfig.TargetPeers[0]
+	}
+
+	channelContext := sdk.ChannelContext(req.ChannelID, fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
+	ledgerClient, err := ledger.New(channelContext)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err.Error())
+		return
+	}
+
+	block, err := query(ledgerClient, req.Peer)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err.Error())
+		return
+	}
+
+	blockD, err := convertBlockToDetail(req.ChannelID, block, &TxDetailOptions{RWSet: req.RWSet})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Println(err.Error())
+		return
+	}
+
+	log.Println("the response is : block ", blockD.Number, "with", len(blockD.Transactions), "transactions")
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": blockD})
+}
+
+// newMSPClient caID为sdk配置中certificateAuthorities的key，为空时使用该org配置中的第一个CA
+// 同时返回该CA在fabric-ca-server中的caName，register及revoke请求需指定
+func newMSPClient(orgName, caID string) (*mspclient.Client, string, error) {
+	if orgName == "" {
+		orgName = serverConfig.OrgName
+	}
+	clientContext, err := sdk.Context()()
+	if err != nil {
+		return nil, "", err
+	}
+	if caID == "" {
+		org, ok := clientContext.EndpointConfig().NetworkConfig().Organizations[strings.ToLower(orgName)]
+		if ok && len(org.CertificateAuthorities) > 0 {
+			caID = org.CertificateAuthorities[0]
+		}
+	}
+	var caName string
+	opts := []mspclient.ClientOption{mspclient.WithOrg(orgName)}
+	if caID != "" {
+		caConfig, ok := clientContext.IdentityConfig().CAConfig(caID)
+		if !ok {
+			return nil, "", fmt.Errorf("ca %s is not configured", caID)
+		}
+		caName = caConfig.CAName
+		opts = append(opts, mspclient.WithCAInstance(caID))
+	}
+	mspClient, err := mspclient.New(sdk.Context(), opts...)
+	return mspClient, caName, err
+}
+
+func enrollOptions(req *EnrollRequest) []mspclient.EnrollmentOption {
+	opts := make([]mspclient.EnrollmentOption, 0)
+	if req.Secret != "" {
+		opts = append(opts, mspclient.WithSecret(req.Secret))
+	}
+	if req.Type != "" {
+		opts = append(opts, mspclient.WithType(req.Type))
+	}
+	if req.Profile != "" {
+		opts = append(opts, mspclient.WithProfile(req.Profile))
+	}
+	if len(req.Attributes) > 0 {
+		attrReqs := make([]*mspclient.AttributeRequest, 0, len(req.Attributes))
+		for _, attr := range req.Attributes {
+			attrReqs = append(attrReqs, &mspclient.AttributeRequest{Name: attr.Name, Optional: attr.Optional})
+		}
+		opts = append(opts, mspclient.WithAttributeRequests(attrReqs))
+	}
+	return opts
+}
+
+// enrolledIdentity 返回已保存到credentialStore中的身份证书
+func enrolledIdentity(mspClient *mspclient.Client, name string) (gin.H, error) {
+	signingIdentity, err := mspClient.GetSigningIdentity(name)
+	if err != nil {
+		return nil, err
+	}
+	certPem := signingIdentity.EnrollmentCertificate()
+	cert, err := decodeX509Pem(certPem)
+	if err != nil {
+		return nil, err
+	}
+	identity := &cachedIdentity{mspID: signingIdentity.Identifier().MSPID, cert: cert}
+	return gin.H{"mspID": identity.mspID, "certificate": string(certPem), "identity": identity.info()}, nil
+}
+
+func registerIdentity(ctx *gin.Context) {
+	req := new(RegisterRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
+
+	mspClient, caName, err := newMSPClient(req.OrgName, req.CAName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	attrs := make([]mspclient.Attribute, 0, len(req.Attributes))
+	for _, attr := range req.Attributes {
+		attrs = append(attrs, mspclient.Attribute{Name: attr.Name, Value: attr.Value, ECert: attr.ECert})
+	}
+	secret, err := mspClient.Register(&mspclient.RegistrationRequest{
+		Name:           req.Name,
+		Type:           req.Type,
+		MaxEnrollments: req.MaxEnrollments,
+		Affiliation:    req.Affiliation,
+		Attributes:     attrs,
+		CAName:         caName,
+		Secret:         req.Secret,
+	})
+	if err != nil {
+		log.Println("the register response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : registered ", req.Name)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "name": req.Name, "secret": secret})
+}
+
+func enrollIdentity(ctx *gin.Context) {
+	req := new(EnrollRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
+	if req.Secret == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "secret is required"})
+		return
+	}
+
+	mspClient, _, err := newMSPClient(req.OrgName, req.CAName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 证书及私钥由sdk保存到credentialStore中
+	if err := mspClient.Enroll(req.Name, enrollOptions(req)...); err != nil {
+		log.Println("the enroll response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := enrolledIdentity(mspClient, req.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : enrolled ", req.Name)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": identity})
+}
+
+func reenrollIdentity(ctx *gin.Context) {
+	req := new(EnrollRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
+	req.Secret = ""
+
+	mspClient, _, err := newMSPClient(req.OrgName, req.CAName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := mspClient.Reenroll(req.Name, enrollOptions(req)...); err != nil {
+		log.Println("the reenroll response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := enrolledIdentity(mspClient, req.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : reenrolled ", req.Name)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": identity})
+}
+
+func revokeIdentity(ctx *gin.Context) {
+	req := new(RevokeRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
+	if req.Name == "" && (req.Serial == "" || req.AKI == "") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name or serial and aki are required"})
+		return
+	}
+
+	mspClient, caName, err := newMSPClient(req.OrgName, req.CAName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := mspClient.Revoke(&mspclient.RevocationRequest{
+		Name:   req.Name,
+		Serial: req.Serial,
+		AKI:    req.AKI,
+		Reason: req.Reason,
+		CAName: caName,
+		GenCRL: req.GenCRL,
+	})
+	if err != nil {
+		log.Println("the revoke response err info is : ", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : revoked ", req.Name, len(resp.RevokedCerts))
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "revokedCerts": resp.RevokedCerts, "crl": string(resp.CRL)})
+}
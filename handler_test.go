@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestChaincodeTargetPeersRequired 请求及配置中都没有peer时返回400，而不是在查询已实例化版本时panic
+func TestChaincodeTargetPeersRequired(t *testing.T) {
+	oldConfig := serverConfig
+	defer func() { serverConfig = oldConfig }()
+	serverConfig = &ServerConfig{}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/cc/create", createCC)
+	router.POST("/cc/update", updateCC)
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/cc/create", `{"channelID":"mychannel","chaincodeID":"fabcar","version":"1.0","path":"github.com/fabcar"}`},
+		{"/cc/update", `{"channelID":"mychannel","chaincodeID":"fabcar","version":"2.0","path":"github.com/fabcar","force":true}`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, test.path, bytes.NewBufferString(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d %s", test.path, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// status of CheckResult
+const (
+	CheckStatusOK     = "ok"
+	CheckStatusFailed = "failed"
+)
+
+// CheckResult is the result of one readiness check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// shuttingDown 收到退出信号后置为1，/readyz返回503使负载均衡停止转发
+// 置为1后等待DrainDelay再停止监听，使探针有机会看到503
+var shuttingDown int32
+
+func durationOrDefault(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// healthz 进程存活即返回200
+func healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": CheckStatusOK})
+}
+
+// readinessCache 缓存最近一次就绪检查的结果，/readyz无需认证，避免每次请求都访问peer及orderer
+// 检查进行中的请求等待并共用同一结果
+type readinessCache struct {
+	mutex   sync.Mutex
+	check   func(ctx context.Context) (int, map[string]*CheckResult)
+	status  int
+	results map[string]*CheckResult
+	checked time.Time
+}
+
+var readiness = &readinessCache{check: checkReadiness}
+
+// get 结果未超过ttl时直接返回，ttl为0时每次都检查
+func (c *readinessCache) get(ttl, timeout time.Duration) (int, map[string]*CheckResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.results != nil && time.Since(c.checked) < ttl {
+		return c.status, c.results
+	}
+	// 不使用请求的context，调用方断开不应使缓存的结果失败
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	c.status, c.results = c.check(ctx)
+	c.checked = time.Now()
+	return c.status, c.results
+}
+
+// readyz 返回缓存的就绪检查结果，退出过程中直接返回503
+func readyz(ctx *gin.Context) {
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": http.StatusServiceUnavailable, "error": "shutting down"})
+		return
+	}
+
+	timeout, err := durationOrDefault(serverConfig.Health.CheckTimeout, 5*time.Second)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ttl, err := durationOrDefault(serverConfig.Health.CacheTTL, 5*time.Second)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, results := readiness.get(ttl, timeout)
+	ctx.JSON(status, gin.H{"status": status, "response": results})
+}
+
+// checkReadiness 检查sdk是否可用、各TargetPeers及TargetOrderer是否可达、通道配置是否可加载
+func checkReadiness(ctx context.Context) (int, map[string]*CheckResult) {
+	// sdk不可用时其余检查无法进行
+	if err := checkSDK(ctx); err != nil {
+		log.Println("the readiness check failed : sdk ====", err.Error())
+		return http.StatusServiceUnavailable, map[string]*CheckResult{"sdk": {Status: CheckStatusFailed, Error: err.Error()}}
+	}
+
+	checks := make(map[string]func(context.Context) error)
+	for _, peer := range serverConfig.TargetPeers {
+		checks["peer "+peer] = checkPeer(peer)
+	}
+	if serverConfig.TargetOrderer != "" {
+		checks["orderer "+serverConfig.TargetOrderer] = checkOrderer(serverConfig.TargetOrderer, serverConfig.Health.ChannelID)
+	}
+	if serverConfig.Health.ChannelID != "" {
+		checks["channel "+serverConfig.Health.ChannelID] = checkChannelConfig(serverConfig.Health.ChannelID)
+	}
+
+	results := make(map[string]*CheckResult, len(checks)+1)
+	results["sdk"] = &CheckResult{Status: CheckStatusOK}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			start := time.Now()
+			result := &CheckResult{Status: CheckStatusOK}
+			if err := check(ctx); err != nil {
+				result.Status = CheckStatusFailed
+				result.Error = err.Error()
+			}
+			result.Duration = time.Since(start).String()
+
+			mutex.Lock()
+			results[name] = result
+			mutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for name, result := range results {
+		if result.Status != CheckStatusOK {
+			log.Println("the readiness check failed : ", name, "====", result.Error)
+			status = http.StatusServiceUnavailable
+		}
+	}
+	return status, results
+}
+
+// checkSDK sdk已初始化且默认身份可加载
+func checkSDK(ctx context.Context) error {
+	if sdk == nil {
+		return errors.New("sdk is not initialized")
+	}
+	return runWithContext(ctx, func() error {
+		_, err := sdk.Context(fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))()
+		return err
+	})
+}
+
+// runWithContext 用于不接受context的sdk调用，超时后直接返回，调用在后台结束
+func runWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func checkPeer(peer string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		resMgmtClient, err := newResMgmtClient()
+		if err != nil {
+			return err
+		}
+		_, err = resMgmtClient.QueryChannels(resmgmt.WithTargetEndpoints(peer), resmgmt.WithParentContext(ctx))
+		return err
+	}
+}
+
+// checkOrderer 配置了通道时从orderer读取通道配置，否则只检查端口是否可连接
+func checkOrderer(orderer, channelID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if channelID != "" {
+			resMgmtClient, err := newResMgmtClient()
+			if err != nil {
+				return err
+			}
+			_, err = resMgmtClient.QueryConfigFromOrderer(channelID, resmgmt.WithOrdererEndpoint(orderer), resmgmt.WithParentContext(ctx))
+			return err
+		}
+
+		clientContext, err := sdk.Context(fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))()
+		if err != nil {
+			return err
+		}
+		ordererConfig, ok, _ := clientContext.EndpointConfig().OrdererConfig(orderer)
+		if !ok {
+			return fmt.Errorf("orderer %s is not configured", orderer)
+		}
+		address := ordererConfig.URL
+		if i := strings.Index(address, "://"); i >= 0 {
+			address = address[i+3:]
+		}
+		conn, err := new(net.Dialer).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// checkChannelConfig 从peer加载通道配置
+func checkChannelConfig(channelID string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		channelContext := sdk.ChannelContext(channelID, fabsdk.WithUser(serverConfig.UserName), fabsdk.WithOrg(serverConfig.OrgName))
+		ledgerClient, err := ledger.New(channelContext)
+		if err != nil {
+			return err
+		}
+		_, err = ledgerClient.QueryConfig(ledger.WithParentContext(ctx))
+		return err
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadinessCache(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	cache := &readinessCache{check: func(ctx context.Context) (int, map[string]*CheckResult) {
+		calls++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the check to run with a timeout")
+		}
+		return status, map[string]*CheckResult{"sdk": {Status: CheckStatusOK}}
+	}}
+
+	// ttl内的请求共用同一次检查的结果
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, _ := cache.get(time.Minute, time.Second); got != http.StatusOK {
+				t.Errorf("expected %d, got %d", http.StatusOK, got)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expected 1 check within the ttl, got %d", calls)
+	}
+
+	// 超过ttl后重新检查
+	status = http.StatusServiceUnavailable
+	cache.checked = time.Now().Add(-2 * time.Minute)
+	if got, _ := cache.get(time.Minute, time.Second); got != http.StatusServiceUnavailable || calls != 2 {
+		t.Errorf("expected a new check after the ttl, got %d after %d checks", got, calls)
+	}
+
+	// ttl为0时每次都检查
+	cache.get(0, time.Second)
+	cache.get(0, time.Second)
+	if calls != 4 {
+		t.Errorf("expected every call to check with a zero ttl, got %d checks", calls)
+	}
+}
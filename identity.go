@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headers to select the fabric identity when not set in the request body
+const (
+	HeaderFabricOrg  = "X-Fabric-Org"
+	HeaderFabricUser = "X-Fabric-User"
+)
+
+// findGinUser 查找配置中的rest用户
+func findGinUser(name string) *GinUser {
+	for i := range serverConfig.GinUsers {
+		if serverConfig.GinUsers[i].User == name {
+			return &serverConfig.GinUsers[i]
+		}
+	}
+	return nil
+}
+
+// allowedIdentities 返回rest用户可使用的fabric身份
+// 客户端证书直接映射为fabric身份时只能使用该身份，未配置identities时只能使用sdkconfig中的默认身份
+func allowedIdentities(ctx *gin.Context, restUser string) []FabricIdentity {
+	if identities, ok := ctx.Get(ctxKeyIdentities); ok {
+		return identities.([]FabricIdentity)
+	}
+	if user := findGinUser(restUser); user != nil && len(user.Identities) > 0 {
+		return user.Identities
+	}
+	return []FabricIdentity{{OrgName: serverConfig.OrgName, UserName: serverConfig.UserName}}
+}
+
+// resolveIdentity 确定本次请求使用的fabric身份
+// 优先使用请求体中的orgName/userName，其次为请求头，均未指定时使用该rest用户的默认身份
+// 只指定其中一个时在允许的身份中匹配另一个
+func resolveIdentity(ctx *gin.Context, orgName, userName string) (*FabricIdentity, error) {
+	if orgName == "" {
+		orgName = ctx.GetHeader(HeaderFabricOrg)
+	}
+	if userName == "" {
+		userName = ctx.GetHeader(HeaderFabricUser)
+	}
+
+	restUser := ctx.GetString(gin.AuthUserKey)
+	allowed := allowedIdentities(ctx, restUser)
+	for _, identity := range allowed {
+		if (orgName == "" || identity.OrgName == orgName) && (userName == "" || identity.UserName == userName) {
+			return &FabricIdentity{OrgName: identity.OrgName, UserName: identity.UserName}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user %s is not allowed to transact as %s@%s", restUser, userName, orgName)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// status of Job
+// JobStatusTimeout means no commit event arrived in time, the transaction may still have been committed,
+// clients must reconcile it through GET /transaction/:txID
+const (
+	JobStatusEndorsed  = "endorsed"
+	JobStatusSubmitted = "submitted"
+	JobStatusCommitted = "committed"
+	JobStatusFailed    = "failed"
+	JobStatusTimeout   = "timeout"
+)
+
+// jobRetention 已结束的job保留时长
+const jobRetention = time.Hour
+
+// Job is the progress of an asynchronous invoke
+// ValidationCode and BlockNumber are set once committed, Valid tells whether the commit is valid
+// Response is formatted as the responseFormat of the invoke, Error is also set when it cannot be formatted
+type Job struct {
+	TxID           string      `json:"txID"`
+	ChannelID      string      `json:"channelID"`
+	ChaincodeID    string      `json:"chaincodeID"`
+	Function       string      `json:"function"`
+	User           string      `json:"user"`
+	Status         string      `json:"status"`
+	Response       interface{} `json:"response,omitempty"`
+	Valid          bool        `json:"valid"`
+	ValidationCode string      `json:"validationCode,omitempty"`
+	BlockNumber    uint64      `json:"blockNumber,omitempty"`
+	Error          string      `json:"error,omitempty"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+func (job *Job) finished() bool {
+	return job.Status == JobStatusCommitted || job.Status == JobStatusFailed || job.Status == JobStatusTimeout
+}
+
+// jobStore 保存异步invoke的进度，pending为尚未结束的invoke，退出时等待其完成
+type jobStore struct {
+	mutex   sync.RWMutex
+	jobs    map[string]*Job
+	pending sync.WaitGroup
+}
+
+var jobs = &jobStore{jobs: make(map[string]*Job)}
+
+func (s *jobStore) add(job *Job) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 顺便清理过期的job
+	for txID, j := range s.jobs {
+		if j.finished() && time.Since(j.UpdatedAt) > jobRetention {
+			delete(s.jobs, txID)
+		}
+	}
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	s.jobs[job.TxID] = job
+}
+
+func (s *jobStore) update(txID string, update func(*Job)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if job, ok := s.jobs[txID]; ok {
+		update(job)
+		job.UpdatedAt = time.Now()
+	}
+}
+
+func (s *jobStore) fail(txID string, err error) {
+	s.update(txID, func(job *Job) {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+	})
+}
+
+// get 返回job的副本
+func (s *jobStore) get(txID string) (*Job, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, ok := s.jobs[txID]
+	if !ok {
+		return nil, false
+	}
+	copied := *job
+	return &copied, true
+}
+
+// wait 等待未结束的异步invoke，超时返回ctx的错误
+func (s *jobStore) wait(ctx context.Context) error {
+	return waitWithContext(ctx, &s.pending)
+}
+
+// waitWithContext 等待wg结束，ctx先结束时返回ctx的错误
+func waitWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trackedCommitHandler 与invoke.CommitTxHandler相同，但在背书完成后通知调用方，并记录提交进度
+type trackedCommitHandler struct {
+	job            Job
+	responseFormat string
+	endorsed       chan string
+}
+
+func newTrackedCommitHandler(job Job, responseFormat string) *trackedCommitHandler {
+	return &trackedCommitHandler{job: job, responseFormat: responseFormat, endorsed: make(chan string, 1)}
+}
+
+func (h *trackedCommitHandler) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	txID := string(requestContext.Response.TransactionID)
+
+	// 先注册事件，避免错过提交事件
+	reg, statusNotifier, err := clientContext.EventService.RegisterTxStatusEvent(txID)
+	if err != nil {
+		requestContext.Error = fmt.Errorf("error registering for TxStatus event: %v", err)
+		return
+	}
+	defer clientContext.EventService.Unregister(reg)
+
+	job := h.job
+	job.TxID = txID
+	job.Status = JobStatusEndorsed
+	if job.Response, err = formatPayload(requestContext.Response.Payload, h.responseFormat); err != nil {
+		job.Error = err.Error()
+	}
+	jobs.add(&job)
+	h.endorsed <- txID
+
+	tx, err := clientContext.Transactor.CreateTransaction(fab.TransactionRequest{
+		Proposal:          requestContext.Response.Proposal,
+		ProposalResponses: requestContext.Response.Responses,
+	})
+	if err == nil {
+		_, err = clientContext.Transactor.SendTransaction(tx)
+	}
+	if err != nil {
+		requestContext.Error = fmt.Errorf("CreateAndSendTransaction failed: %v", err)
+		jobs.fail(txID, requestContext.Error)
+		return
+	}
+	jobs.update(txID, func(job *Job) { job.Status = JobStatusSubmitted })
+
+	select {
+	case txStatus := <-statusNotifier:
+		requestContext.Response.TxValidationCode = txStatus.TxValidationCode
+		jobs.update(txID, func(job *Job) {
+			job.Status = JobStatusCommitted
+			job.Valid = txStatus.TxValidationCode == pb.TxValidationCode_VALID
+			job.ValidationCode = txStatus.TxValidationCode.String()
+			job.BlockNumber = txStatus.BlockNumber
+		})
+		if txStatus.TxValidationCode != pb.TxValidationCode_VALID {
+			requestContext.Error = status.New(status.EventServerStatus, int32(txStatus.TxValidationCode),
+				"received invalid transaction", nil)
+		}
+	case <-requestContext.Ctx.Done():
+		requestContext.Error = status.New(status.ClientStatus, status.Timeout.ToInt32(),
+			"Execute didn't receive block event", nil)
+		// 交易已发送，可能仍会被提交，不能视为失败
+		jobs.update(txID, func(job *Job) {
+			job.Status = JobStatusTimeout
+			job.Error = requestContext.Error.Error() + ", query /transaction/" + txID + " for the final status"
+		})
+	}
+}
+
+// queryJob 处理 GET /jobs/:txID，查询异步invoke的进度
+// 只有提交该invoke的rest用户及admin角色可查询，其他用户视为不存在
+func queryJob(ctx *gin.Context) {
+	restUser := ctx.GetString(gin.AuthUserKey)
+	job, ok := jobs.get(ctx.Param("txID"))
+	if !ok || (job.User != restUser && !hasRole(ctx, restUser, RoleAdmin)) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: job.ChannelID, ChaincodeID: job.ChaincodeID, Function: job.Function}) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": job})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+func TestQueryJob(t *testing.T) {
+	oldConfig, oldJobs := serverConfig, jobs
+	defer func() { serverConfig, jobs = oldConfig, oldJobs }()
+	serverConfig = &ServerConfig{}
+	serverConfig.GinUsers = []GinUser{
+		{User: "user1", Roles: []string{"operator"}},
+		{User: "user2", Roles: []string{"operator"}},
+		{User: "root", Roles: []string{RoleAdmin}},
+	}
+	jobs = &jobStore{jobs: make(map[string]*Job)}
+	jobs.add(&Job{TxID: "tx1", ChannelID: "mychannel", ChaincodeID: "fabcar", User: "user1", Status: JobStatusSubmitted})
+
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		user   string
+		txID   string
+		status int
+	}{
+		{"user1", "tx1", http.StatusOK},
+		// 其他用户看不到该job是否存在
+		{"user2", "tx1", http.StatusNotFound},
+		{"cert:CN=user1,OU=client,O=Org1", "tx1", http.StatusNotFound},
+		{"root", "tx1", http.StatusOK},
+		{"user1", "tx2", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		router := gin.New()
+		user := test.user
+		router.Use(func(ctx *gin.Context) { ctx.Set(gin.AuthUserKey, user) })
+		router.GET("/jobs/:txID", queryJob)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+test.txID, nil))
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d %s", test.user, test.txID, test.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+// fakeCommitter 只实现trackedCommitHandler用到的事件及发送交易的方法
+// statuses为nil时不返回提交事件
+type fakeCommitter struct {
+	fab.EventService
+	fab.Transactor
+	sendErr  error
+	statuses chan *fab.TxStatusEvent
+}
+
+func (c *fakeCommitter) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	return nil, c.statuses, nil
+}
+
+func (c *fakeCommitter) Unregister(reg fab.Registration) {}
+
+func (c *fakeCommitter) CreateTransaction(request fab.TransactionRequest) (*fab.Transaction, error) {
+	return &fab.Transaction{}, nil
+}
+
+func (c *fakeCommitter) SendTransaction(tx *fab.Transaction) (*fab.TransactionResponse, error) {
+	return &fab.TransactionResponse{}, c.sendErr
+}
+
+func TestTrackedCommitHandler(t *testing.T) {
+	oldJobs := jobs
+	defer func() { jobs = oldJobs }()
+
+	committed := func(code pb.TxValidationCode) chan *fab.TxStatusEvent {
+		statuses := make(chan *fab.TxStatusEvent, 1)
+		statuses <- &fab.TxStatusEvent{TxID: "tx1", TxValidationCode: code, BlockNumber: 8}
+		return statuses
+	}
+	tests := []struct {
+		name      string
+		committer *fakeCommitter
+		status    string
+		valid     bool
+		errs      string
+	}{
+		{"committed", &fakeCommitter{statuses: committed(pb.TxValidationCode_VALID)}, JobStatusCommitted, true, ""},
+		{"committed invalid", &fakeCommitter{statuses: committed(pb.TxValidationCode_MVCC_READ_CONFLICT)}, JobStatusCommitted, false, ""},
+		{"send failed", &fakeCommitter{sendErr: errors.New("orderer unavailable")}, JobStatusFailed, false, "orderer unavailable"},
+		// 等待提交超时，交易可能仍会被提交
+		{"commit wait timeout", &fakeCommitter{}, JobStatusTimeout, false, "/transaction/tx1"},
+	}
+
+	for _, test := range tests {
+		jobs = &jobStore{jobs: make(map[string]*Job)}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		requestContext := &invoke.RequestContext{Ctx: ctx, Response: invoke.Response{TransactionID: "tx1", Payload: []byte("ok")}}
+		clientContext := &invoke.ClientContext{EventService: test.committer, Transactor: test.committer}
+
+		handler := newTrackedCommitHandler(Job{ChannelID: "mychannel", ChaincodeID: "fabcar", User: "user1"}, "")
+		handler.Handle(requestContext, clientContext)
+		cancel()
+
+		if txID := <-handler.endorsed; txID != "tx1" {
+			t.Errorf("%s: expected endorsed tx1, got %s", test.name, txID)
+		}
+		job, ok := jobs.get("tx1")
+		if !ok {
+			t.Fatalf("%s: job not found", test.name)
+		}
+		if job.Status != test.status || job.Valid != test.valid || !job.finished() {
+			t.Errorf("%s: expected %s valid %v, got %+v", test.name, test.status, test.valid, job)
+		}
+		if !strings.Contains(job.Error, test.errs) || test.errs == "" && job.Error != "" {
+			t.Errorf("%s: expected error %q, got %q", test.name, test.errs, job.Error)
+		}
+		if (requestContext.Error == nil) != (test.status == JobStatusCommitted && test.valid) {
+			t.Errorf("%s: unexpected request error %v", test.name, requestContext.Error)
+		}
+		if test.status == JobStatusCommitted && (job.BlockNumber != 8 || job.ValidationCode == "") {
+			t.Errorf("%s: expected the commit to be recorded, got %+v", test.name, job)
+		}
+	}
+}
@@ -7,10 +7,17 @@ Fabric-sdk-go is the latest.
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
@@ -21,7 +28,6 @@ import (
 var (
 	serverConfig *ServerConfig
 	sdk          *fabsdk.FabricSDK
-	request      *Parameters
 )
 
 func main() {
@@ -45,13 +51,37 @@ func main() {
 	serverBytes, _ := json.Marshal(serverConfig)
 	fmt.Println(string(serverBytes))
 
+	if err := validateACL(&serverConfig.RestfulServer); err != nil {
+		panic(err.Error())
+	}
+
+	subscriptions, err = newSubscriptionManager(&serverConfig.Webhook)
+	if err != nil {
+		panic(err.Error())
+	}
+
 	router := gin.Default()
 
-	accounts := make(map[string]string, len(serverConfig.GinUsers))
-	for _, account := range serverConfig.GinUsers {
-		accounts[account.User] = account.Passwd
+	auths, err := newAuthenticators(&serverConfig.Auth)
+	if err != nil {
+		panic(err.Error())
 	}
-	authorized := router.Group("/", gin.BasicAuth(accounts))
+	authorized := router.Group("/", authMiddleware(auths))
+
+	// 启用jwt时提供登录接口，使用用户名密码换取token
+	for _, auth := range auths {
+		if jwtAuth, ok := auth.(*jwtAuthenticator); ok {
+			basic, err := newBasicAuthenticator(serverConfig.GinUsers)
+			if err != nil {
+				panic(err.Error())
+			}
+			router.POST("/auth/token", issueToken(basic, jwtAuth))
+		}
+	}
+
+	// 供kubernetes探针使用，无需认证
+	router.GET("/healthz", healthz)
+	router.GET("/readyz", readyz)
 
 	authorized.POST("/hello", hello)
 	authorized.POST("/channel/create", createChannel)
@@ -61,8 +91,92 @@ func main() {
 	authorized.POST("/cc/invoke", invokeCC)
 	authorized.POST("/cc/update", updateCC)
 	authorized.GET("/cc/query", queryCC)
+	authorized.POST("/cc/batch", batchCC)
+	authorized.GET("/jobs/:txID", queryJob)
 
 	authorized.GET("/transaction/:txID", queryTransactionByTxID)
 
-	router.Run(":" + serverConfig.Port)
+	authorized.POST("/identity/register", registerIdentity)
+	authorized.POST("/identity/enroll", enrollIdentity)
+	authorized.POST("/identity/reenroll", reenrollIdentity)
+	authorized.POST("/identity/revoke", revokeIdentity)
+
+	authorized.GET("/block/:number", queryBlockByNumber)
+	// gin v1.6的路由不允许/block/下同时存在静态路径和通配符:number，按hash查询使用单独的路径
+	authorized.GET("/block-by-hash/:hash", queryBlockByHash)
+
+	// server-sent events，事件id可作为resume或Last-Event-ID续传
+	authorized.GET("/events/blocks", streamBlocks)
+	authorized.GET("/events/filtered-blocks", streamFilteredBlocks)
+	authorized.GET("/events/chaincode", streamChaincodeEvents)
+
+	// webhook订阅，服务重启后从checkpoint继续投递
+	authorized.POST("/subscriptions", createSubscription)
+	authorized.GET("/subscriptions", listSubscriptions)
+	authorized.GET("/subscriptions/:id", getSubscription)
+	authorized.DELETE("/subscriptions/:id", deleteSubscription)
+	authorized.GET("/subscriptions/:id/dead-letters", listDeadLetters)
+
+	tlsConfig, err := newTLSConfig(&serverConfig.TLS)
+	if err != nil {
+		panic(err.Error())
+	}
+	server := &http.Server{
+		Addr:      ":" + serverConfig.Port,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+	server.RegisterOnShutdown(func() { close(streamsClosing) })
+	shutdownTimeout, err := durationOrDefault(serverConfig.Health.ShutdownTimeout, 30*time.Second)
+	if err != nil {
+		panic(err.Error())
+	}
+	drainDelay, err := durationOrDefault(serverConfig.Health.DrainDelay, 5*time.Second)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	subscriptions.start()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			// 证书已加载到TLSConfig中
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		panic(err.Error())
+	case sig := <-quit:
+		log.Println("the received signal is : ", sig, ", shutting down")
+	}
+
+	// /readyz先返回503，负载均衡摘除后再停止接收新请求，再次收到信号时立即停止
+	atomic.StoreInt32(&shuttingDown, 1)
+	select {
+	case <-time.After(drainDelay):
+	case sig := <-quit:
+		log.Println("the received signal is : ", sig, ", skipping the drain delay")
+	}
+
+	// 停止接收新请求，等待处理中的请求(如invoke)完成后再关闭sdk
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("the shutdown err info is : ", err.Error())
+	}
+	// 异步invoke在请求返回后仍在等待提交
+	if err := jobs.wait(ctx); err != nil {
+		log.Println("the pending async invokes are abandoned : ", err.Error())
+	}
+	// webhook投递在streamsClosing关闭后结束，未投递成功的内容重启后重新投递
+	if err := subscriptions.wait(ctx); err != nil {
+		log.Println("the webhook workers are abandoned : ", err.Error())
+	}
 }
@@ -1,9 +1,20 @@
 package main
 
 // GinUser for gin
+// Passwd is the bcrypt hash of the password
+// Identities are the fabric identities the user may transact as, the first one is the default
+// Roles are checked against RestfulServer.ACL
 type GinUser struct {
-	User   string `json:"user,omitempty" yaml:"user,omitempty"`
-	Passwd string `json:"passwd,omitempty" yaml:"passwd,omitempty"`
+	User       string           `json:"user,omitempty" yaml:"user,omitempty"`
+	Passwd     string           `json:"passwd,omitempty" yaml:"passwd,omitempty"`
+	Identities []FabricIdentity `json:"identities,omitempty" yaml:"identities,omitempty"`
+	Roles      []string         `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// FabricIdentity define an enrolled fabric user of an org
+type FabricIdentity struct {
+	OrgName  string `json:"orgName,omitempty" yaml:"orgName,omitempty"`
+	UserName string `json:"userName,omitempty" yaml:"userName,omitempty"`
 }
 
 // SDKConfig for fabric-sdk-go
@@ -13,6 +24,7 @@ type SDKConfig struct {
 	UserName      string   `json:"userName,omitempty" yaml:"userName,omitempty" `
 	TargetPeers   []string `json:"targetPeers,omitempty" yaml:"targetPeers,omitempty"`
 	TargetOrderer string   `json:"targetOrderer,omitempty" yaml:"targetOrderer,omitempty"`
+	SignOrgs      []string `json:"signOrgs,omitempty" yaml:"signOrgs,omitempty"`
 }
 
 // Channel define channel info
@@ -23,9 +35,127 @@ type Channel struct {
 }
 
 // RestfulServer for server
+// Roles declare the roles assignable to users, ACL is not enforced when it has no rules
 type RestfulServer struct {
-	Port     string    `json:"port,omitempty" yaml:"port,omitempty" `
-	GinUsers []GinUser `json:"ginuser,omitempty" yaml:"ginuser,omitempty" `
+	Port     string        `json:"port,omitempty" yaml:"port,omitempty" `
+	GinUsers []GinUser     `json:"ginuser,omitempty" yaml:"ginuser,omitempty" `
+	Auth     AuthConfig    `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Roles    []string      `json:"roles,omitempty" yaml:"roles,omitempty"`
+	ACL      []ACLRule     `json:"acl,omitempty" yaml:"acl,omitempty"`
+	TLS      TLSConfig     `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Health   HealthConfig  `json:"health,omitempty" yaml:"health,omitempty"`
+	Webhook  WebhookConfig `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	Batch    BatchConfig   `json:"batch,omitempty" yaml:"batch,omitempty"`
+}
+
+// BatchConfig define the limits of /cc/batch
+// MaxOperations is the number of operations accepted in one batch, default to 1000
+// MaxConcurrency caps the concurrency requested by the client, default to 16
+type BatchConfig struct {
+	MaxOperations  int `json:"maxOperations,omitempty" yaml:"maxOperations,omitempty"`
+	MaxConcurrency int `json:"maxConcurrency,omitempty" yaml:"maxConcurrency,omitempty"`
+}
+
+// WebhookConfig define the delivery of webhook subscriptions
+// StorePath is the json file keeping subscriptions, checkpoints and dead letters, default to ./data/subscriptions.json
+// a delivery is tried MaxAttempts times (default 5) with the backoff doubling from InitialBackoff (default 1s)
+// up to MaxBackoff (default 1m), Timeout is per request (default 10s)
+// DeadLetterLimit is the number of dead letters kept per subscription, default to 100
+// AllowHosts limits the subscription url hosts when not empty, "*.example.com" matches the subdomains
+// DenyNetworks are the CIDRs a webhook may never connect to, default to loopback, private and link-local networks
+type WebhookConfig struct {
+	StorePath       string   `json:"storePath,omitempty" yaml:"storePath,omitempty"`
+	MaxAttempts     int      `json:"maxAttempts,omitempty" yaml:"maxAttempts,omitempty"`
+	InitialBackoff  string   `json:"initialBackoff,omitempty" yaml:"initialBackoff,omitempty"`
+	MaxBackoff      string   `json:"maxBackoff,omitempty" yaml:"maxBackoff,omitempty"`
+	Timeout         string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	DeadLetterLimit int      `json:"deadLetterLimit,omitempty" yaml:"deadLetterLimit,omitempty"`
+	AllowHosts      []string `json:"allowHosts,omitempty" yaml:"allowHosts,omitempty"`
+	DenyNetworks    []string `json:"denyNetworks,omitempty" yaml:"denyNetworks,omitempty"`
+}
+
+// HealthConfig define the readiness checks and graceful shutdown
+// ChannelID is the channel whose config /readyz loads from the peers and the orderer
+// CheckTimeout default to 5s, ShutdownTimeout is how long in-flight requests may drain, default to 30s
+// DrainDelay is how long /readyz reports 503 before the listener closes, default to 5s, 0s disables it
+// CacheTTL is how long /readyz reuses the last result, default to 5s, 0s checks on every call
+type HealthConfig struct {
+	ChannelID       string `json:"channelID,omitempty" yaml:"channelID,omitempty"`
+	CheckTimeout    string `json:"checkTimeout,omitempty" yaml:"checkTimeout,omitempty"`
+	ShutdownTimeout string `json:"shutdownTimeout,omitempty" yaml:"shutdownTimeout,omitempty"`
+	DrainDelay      string `json:"drainDelay,omitempty" yaml:"drainDelay,omitempty"`
+	CacheTTL        string `json:"cacheTTL,omitempty" yaml:"cacheTTL,omitempty"`
+}
+
+// TLSConfig define the https listener
+// MinVersion is 1.0 to 1.3, default to 1.2, CipherSuites are go names such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+// ClientAuth is none, request or require, client certificates are verified against ClientCAs
+type TLSConfig struct {
+	Enabled      bool                `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Cert         string              `json:"cert,omitempty" yaml:"cert,omitempty"`
+	Key          string              `json:"key,omitempty" yaml:"key,omitempty"`
+	MinVersion   string              `json:"minVersion,omitempty" yaml:"minVersion,omitempty"`
+	CipherSuites []string            `json:"cipherSuites,omitempty" yaml:"cipherSuites,omitempty"`
+	ClientAuth   string              `json:"clientAuth,omitempty" yaml:"clientAuth,omitempty"`
+	ClientCAs    []string            `json:"clientCAs,omitempty" yaml:"clientCAs,omitempty"`
+	ClientCerts  []ClientCertMapping `json:"clientCerts,omitempty" yaml:"clientCerts,omitempty"`
+}
+
+// ClientCertMapping maps a client certificate to a rest user or directly to a fabric identity
+// Subject must equal the full subject DN of the certificate, e.g. "CN=alice,OU=client,O=Org1"
+// Roles are used by the ACL only when mapped to an identity, a mapped user keeps its own roles
+// a certificate mapped to an identity authenticates as "cert:" followed by its subject DN
+type ClientCertMapping struct {
+	Subject  string          `json:"subject,omitempty" yaml:"subject,omitempty"`
+	User     string          `json:"user,omitempty" yaml:"user,omitempty"`
+	Identity *FabricIdentity `json:"identity,omitempty" yaml:"identity,omitempty"`
+	Roles    []string        `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// ACLRule binds roles to routes and optionally to channels, chaincodes and functions
+// Routes are "METHOD /path" or "/path" matched against the gin route, e.g. "POST /cc/update"
+// patterns use path.Match wildcards and "*" matches anything, empty Channels, Chaincodes
+// or Functions match any request, Effect is allow or deny, default to allow
+// rules are checked in order and the first matching rule decides
+type ACLRule struct {
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Effect     string   `json:"effect,omitempty" yaml:"effect,omitempty"`
+	Roles      []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Routes     []string `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Channels   []string `json:"channels,omitempty" yaml:"channels,omitempty"`
+	Chaincodes []string `json:"chaincodes,omitempty" yaml:"chaincodes,omitempty"`
+	Functions  []string `json:"functions,omitempty" yaml:"functions,omitempty"`
+}
+
+// AuthConfig define the authentication methods, tried in order
+// Methods are basic, jwt and apikey, default to basic
+type AuthConfig struct {
+	Methods []string  `json:"methods,omitempty" yaml:"methods,omitempty"`
+	JWT     JWTConfig `json:"jwt,omitempty" yaml:"jwt,omitempty"`
+	APIKeys []APIKey  `json:"apiKeys,omitempty" yaml:"apiKeys,omitempty"`
+}
+
+// JWTConfig define the jwt bearer token authentication
+// HS256 reads its secret from SecretFile, the env var named by SecretEnv or Secret, in this order
+// the secret must be at least 32 bytes and not a placeholder
+// PublicKey and PrivateKey are pem file paths used by RS256
+// the sub of a token must be one of the ginusers
+type JWTConfig struct {
+	Algorithm  string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Secret     string `json:"-" yaml:"secret,omitempty"`
+	SecretEnv  string `json:"secretEnv,omitempty" yaml:"secretEnv,omitempty"`
+	SecretFile string `json:"secretFile,omitempty" yaml:"secretFile,omitempty"`
+	PublicKey  string `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	PrivateKey string `json:"privateKey,omitempty" yaml:"privateKey,omitempty"`
+	Issuer     string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	Audience   string `json:"audience,omitempty" yaml:"audience,omitempty"`
+	Expiration string `json:"expiration,omitempty" yaml:"expiration,omitempty"`
+}
+
+// APIKey define a static api key of a user, KeyHash is the sha256 hex of the key
+type APIKey struct {
+	User    string `json:"user,omitempty" yaml:"user,omitempty"`
+	KeyHash string `json:"keyHash,omitempty" yaml:"keyHash,omitempty"`
 }
 
 // Chaincode define a chaincode
@@ -42,9 +172,193 @@ type ServerConfig struct {
 }
 
 // Parameters define Parameters struct
+// OrgName and UserName select the fabric identity, see resolveIdentity
+// Args and Transient values are plain strings or encoded values, see Arg
+// ResponseFormat is raw (default), base64 or json
 type Parameters struct {
-	ChannelID   string   `json:"channelID,omitempty" yaml:"channelID,omitempty"`
-	ChaincodeID string   `json:"chaincodeID,omitempty" yaml:"chaincodeID,omitempty"`
-	Function    string   `json:"function,omitempty" yaml:"function,omitempty"`
-	Args        []string `json:"args,omitempty" yaml:"args,omitempty"`
+	ChannelID      string       `json:"channelID,omitempty" yaml:"channelID,omitempty"`
+	ChaincodeID    string       `json:"chaincodeID,omitempty" yaml:"chaincodeID,omitempty"`
+	Function       string       `json:"function,omitempty" yaml:"function,omitempty"`
+	Args           []Arg        `json:"args,omitempty" yaml:"args,omitempty"`
+	Transient      TransientMap `json:"transient,omitempty" yaml:"transient,omitempty"`
+	ResponseFormat string       `json:"responseFormat,omitempty" yaml:"responseFormat,omitempty"`
+	OrgName        string       `json:"orgName,omitempty" yaml:"orgName,omitempty"`
+	UserName       string       `json:"userName,omitempty" yaml:"userName,omitempty"`
+}
+
+// BatchOperation is one invoke or query of a batch
+type BatchOperation struct {
+	Type string `json:"type,omitempty" binding:"required"`
+	Parameters
+}
+
+// BatchRequest define the request of /cc/batch
+// Concurrency is the number of operations executed at the same time, default to 1 which keeps the order of invokes
+// StopOnError skips the operations not yet started once one fails, they are also skipped once the client disconnects
+type BatchRequest struct {
+	Operations  []BatchOperation `json:"operations,omitempty" binding:"required,dive"`
+	Concurrency int              `json:"concurrency,omitempty"`
+	StopOnError bool             `json:"stopOnError,omitempty"`
+}
+
+// CreateChannelRequest define the request of creating channel
+// ChannelTx is the base64 encoded channel transaction, used when no file is uploaded
+type CreateChannelRequest struct {
+	ChannelID string `json:"channelID,omitempty" form:"channelID" binding:"required"`
+	ChannelTx string `json:"channelTx,omitempty" form:"channelTx"`
+}
+
+// JoinChannelRequest define the request of joining channel
+// TargetPeers default to SDKConfig.TargetPeers
+type JoinChannelRequest struct {
+	ChannelID   string   `json:"channelID,omitempty" binding:"required"`
+	TargetPeers []string `json:"targetPeers,omitempty"`
+}
+
+// peer status of PeerResult
+const (
+	PeerStatusJoined           = "joined"
+	PeerStatusAlreadyMember    = "already-member"
+	PeerStatusInstalled        = "installed"
+	PeerStatusAlreadyInstalled = "already-installed"
+	PeerStatusFailed           = "failed"
+)
+
+// PeerResult define the result of an operation on one peer
+type PeerResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// QueryChannelRequest define the request of querying channel
+// Peer default to all of SDKConfig.TargetPeers, ledger info is returned only when ChannelID is set
+type QueryChannelRequest struct {
+	ChannelID string `json:"channelID,omitempty" form:"channelID"`
+	Peer      string `json:"peer,omitempty" form:"peer"`
+}
+
+// LedgerInfo define the ledger info of a channel on a peer
+type LedgerInfo struct {
+	Height            uint64 `json:"height"`
+	CurrentBlockHash  string `json:"currentBlockHash"`
+	PreviousBlockHash string `json:"previousBlockHash"`
+}
+
+// PeerChannelInfo define the channels joined by a peer
+type PeerChannelInfo struct {
+	Channels []string    `json:"channels"`
+	Joined   bool        `json:"joined,omitempty"`
+	Ledger   *LedgerInfo `json:"ledger,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// CreateCCRequest define the request of installing and instantiating chaincode
+// the chaincode is packaged from Path unless a ccPackage file is uploaded
+type CreateCCRequest struct {
+	ChannelID   string   `json:"channelID,omitempty" form:"channelID" binding:"required"`
+	ChaincodeID string   `json:"chaincodeID,omitempty" form:"chaincodeID" binding:"required"`
+	Version     string   `json:"version,omitempty" form:"version" binding:"required"`
+	Path        string   `json:"path,omitempty" form:"path" binding:"required"`
+	TargetPeers []string `json:"targetPeers,omitempty" form:"targetPeers"`
+	Policy      string   `json:"policy,omitempty" form:"policy"`
+	Args        []string `json:"args,omitempty" form:"args"`
+	// CollectionConfig is the JSON of private data collections, the same as collections_config.json
+	CollectionConfig string `json:"collectionConfig,omitempty" form:"collectionConfig"`
+}
+
+// UpdateCCRequest define the request of upgrading chaincode
+// Force allows downgrading, upgrading to the instantiated version is always refused
+type UpdateCCRequest struct {
+	CreateCCRequest
+	Force bool `json:"force,omitempty" form:"force"`
+}
+
+// QueryBlockRequest define the request of querying block
+// Peer default to the first of SDKConfig.TargetPeers
+type QueryBlockRequest struct {
+	ChannelID string `json:"channelID,omitempty" form:"channelID" binding:"required"`
+	Peer      string `json:"peer,omitempty" form:"peer"`
+	RWSet     bool   `json:"rwset,omitempty" form:"rwset"`
+}
+
+// EventStreamRequest define the request of streaming block or chaincode events
+// From is a block number, oldest or newest, default to newest which streams only blocks committed from now on
+// Resume is the id of the last received event, the Last-Event-ID header is used when it is empty
+// Event is a regular expression of the chaincode event name, default to all events
+type EventStreamRequest struct {
+	ChannelID   string `json:"channelID,omitempty" form:"channelID" binding:"required"`
+	ChaincodeID string `json:"ccID,omitempty" form:"ccID"`
+	Event       string `json:"event,omitempty" form:"event"`
+	From        string `json:"from,omitempty" form:"from"`
+	Resume      string `json:"resume,omitempty" form:"resume"`
+	Peer        string `json:"peer,omitempty" form:"peer"`
+	RWSet       bool   `json:"rwset,omitempty" form:"rwset"`
+}
+
+// SubscriptionRequest define the request of creating a webhook subscription
+// Type is chaincode (default) for chaincode events or commit for every committed transaction of the chaincode
+// Event is a regular expression of the chaincode event name, From is a block number, oldest or newest (default)
+// Secret signs the payloads, a random one is generated and returned when empty
+// OrgName and UserName select the fabric identity reading the ledger, see resolveIdentity
+type SubscriptionRequest struct {
+	ChannelID   string `json:"channelID,omitempty" binding:"required"`
+	ChaincodeID string `json:"chaincodeID,omitempty" binding:"required"`
+	Type        string `json:"type,omitempty"`
+	Event       string `json:"event,omitempty"`
+	URL         string `json:"url,omitempty" binding:"required"`
+	Secret      string `json:"secret,omitempty"`
+	From        string `json:"from,omitempty"`
+	OrgName     string `json:"orgName,omitempty"`
+	UserName    string `json:"userName,omitempty"`
+}
+
+// CAAttribute define an attribute registered with the identity
+type CAAttribute struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+	ECert bool   `json:"ecert,omitempty"`
+}
+
+// CAAttributeRequest define an attribute requested in the enrollment certificate
+type CAAttributeRequest struct {
+	Name     string `json:"name,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// RegisterRequest define the request of registering an identity with fabric ca
+// OrgName default to SDKConfig.OrgName
+// CAName is the key of certificateAuthorities in the sdk config, default to the first CA of the org
+type RegisterRequest struct {
+	OrgName        string        `json:"orgName,omitempty"`
+	CAName         string        `json:"caName,omitempty"`
+	Name           string        `json:"name,omitempty" binding:"required"`
+	Type           string        `json:"type,omitempty"`
+	Secret         string        `json:"secret,omitempty"`
+	MaxEnrollments int           `json:"maxEnrollments,omitempty"`
+	Affiliation    string        `json:"affiliation,omitempty"`
+	Attributes     []CAAttribute `json:"attributes,omitempty"`
+}
+
+// EnrollRequest define the request of enrolling or reenrolling an identity
+// Secret is not used when reenrolling
+type EnrollRequest struct {
+	OrgName    string               `json:"orgName,omitempty"`
+	CAName     string               `json:"caName,omitempty"`
+	Name       string               `json:"name,omitempty" binding:"required"`
+	Secret     string               `json:"secret,omitempty"`
+	Type       string               `json:"type,omitempty"`
+	Profile    string               `json:"profile,omitempty"`
+	Attributes []CAAttributeRequest `json:"attributes,omitempty"`
+}
+
+// RevokeRequest define the request of revoking an identity or a certificate
+// either Name or Serial and AKI must be set
+type RevokeRequest struct {
+	OrgName string `json:"orgName,omitempty"`
+	CAName  string `json:"caName,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Serial  string `json:"serial,omitempty"`
+	AKI     string `json:"aki,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	GenCRL  bool   `json:"genCRL,omitempty"`
 }
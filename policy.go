@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+// PolicyError 背书策略解析错误，Pos为出错token在表达式中的位置(从0开始)
+type PolicyError struct {
+	Pos   int
+	Token string
+	Msg   string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid policy at position %d: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("invalid policy at position %d near %q: %s", e.Pos, e.Token, e.Msg)
+}
+
+const (
+	tokenIdent = iota
+	tokenString
+	tokenNumber
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenEOF
+)
+
+type policyToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+var principalRegex = regexp.MustCompile(fmt.Sprintf("^([[:alnum:].-]+)[.](%s|%s|%s|%s|%s)$",
+	policydsl.RoleAdmin, policydsl.RoleMember, policydsl.RoleClient, policydsl.RolePeer, policydsl.RoleOrderer))
+
+// ParsePolicy 解析背书策略表达式，如 OR('Org1MSP.member', AND('Org2MSP.peer','Org3MSP.admin'))
+// 先校验语法以给出出错位置，再交给policydsl生成SignaturePolicyEnvelope
+// 表达式为空时返回nil，使用sdk默认策略
+func ParsePolicy(policy string) (*cb.SignaturePolicyEnvelope, error) {
+	if strings.TrimSpace(policy) == "" {
+		return nil, nil
+	}
+
+	tokens, err := tokenizePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	// policydsl要求最外层为gate
+	if tok := tokens[0]; tok.kind == tokenString {
+		return nil, &PolicyError{Pos: tok.pos, Token: tok.text, Msg: "principal must be wrapped in a gate, e.g. OR('Org1MSP.member')"}
+	}
+	p := &policyParser{tokens: tokens}
+	if err := p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &PolicyError{Pos: tok.pos, Token: tok.text, Msg: "unexpected token after end of policy"}
+	}
+
+	return policydsl.FromString(policy)
+}
+
+func tokenizePolicy(policy string) ([]policyToken, error) {
+	tokens := make([]policyToken, 0)
+	runes := []rune(policy)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, policyToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, policyToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, policyToken{kind: tokenComma, text: ",", pos: i})
+			i++
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &PolicyError{Pos: i, Token: string(runes[i:]), Msg: "unterminated string"}
+			}
+			tokens = append(tokens, policyToken{kind: tokenString, text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, policyToken{kind: tokenNumber, text: string(runes[i:end]), pos: i})
+			i = end
+		case unicode.IsLetter(r):
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			tokens = append(tokens, policyToken{kind: tokenIdent, text: string(runes[i:end]), pos: i})
+			i = end
+		default:
+			return nil, &PolicyError{Pos: i, Token: string(r), Msg: "unexpected character"}
+		}
+	}
+	tokens = append(tokens, policyToken{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type policyParser struct {
+	tokens []policyToken
+	cur    int
+}
+
+func (p *policyParser) peek() policyToken {
+	return p.tokens[p.cur]
+}
+
+func (p *policyParser) next() policyToken {
+	tok := p.tokens[p.cur]
+	if tok.kind != tokenEOF {
+		p.cur++
+	}
+	return tok
+}
+
+func (p *policyParser) expect(kind int, what string) (policyToken, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		if tok.kind == tokenEOF {
+			return tok, &PolicyError{Pos: tok.pos, Msg: fmt.Sprintf("expected %s but policy ended", what)}
+		}
+		return tok, &PolicyError{Pos: tok.pos, Token: tok.text, Msg: fmt.Sprintf("expected %s", what)}
+	}
+	return tok, nil
+}
+
+// parseExpr 解析 principal 或 GATE(P[, P])
+func (p *policyParser) parseExpr() error {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString:
+		if !principalRegex.MatchString(tok.text) {
+			return &PolicyError{Pos: tok.pos, Token: tok.text, Msg: "principal must be 'MSPID.ROLE' with ROLE one of admin, member, client, peer, orderer"}
+		}
+		return nil
+	case tokenIdent:
+		return p.parseGate(tok)
+	case tokenEOF:
+		return &PolicyError{Pos: tok.pos, Msg: "expected principal or gate but policy ended"}
+	default:
+		return &PolicyError{Pos: tok.pos, Token: tok.text, Msg: "expected principal or gate"}
+	}
+}
+
+// policyGates 与policydsl.FromString接受的写法一致，value表示是否为OutOf
+var policyGates = map[string]bool{
+	policydsl.GateAnd:                    false,
+	strings.ToLower(policydsl.GateAnd):   false,
+	strings.ToUpper(policydsl.GateAnd):   false,
+	policydsl.GateOr:                     false,
+	strings.ToLower(policydsl.GateOr):    false,
+	strings.ToUpper(policydsl.GateOr):    false,
+	policydsl.GateOutOf:                  true,
+	strings.ToLower(policydsl.GateOutOf): true,
+	strings.ToUpper(policydsl.GateOutOf): true,
+}
+
+func (p *policyParser) parseGate(gate policyToken) error {
+	outOf, ok := policyGates[gate.text]
+	if !ok {
+		return &PolicyError{Pos: gate.pos, Token: gate.text, Msg: "unknown gate, expected And, Or or OutOf in title, lower or upper case"}
+	}
+
+	if _, err := p.expect(tokenLParen, "'('"); err != nil {
+		return err
+	}
+
+	n := -1
+	if outOf {
+		numTok, err := p.expect(tokenNumber, "number of required signatures")
+		if err != nil {
+			return err
+		}
+		n, _ = strconv.Atoi(numTok.text)
+		if _, err := p.expect(tokenComma, "','"); err != nil {
+			return err
+		}
+	}
+
+	count := 0
+	for {
+		if err := p.parseExpr(); err != nil {
+			return err
+		}
+		count++
+
+		tok := p.next()
+		if tok.kind == tokenRParen {
+			break
+		}
+		if tok.kind != tokenComma {
+			if tok.kind == tokenEOF {
+				return &PolicyError{Pos: tok.pos, Msg: fmt.Sprintf("missing ')' for %s opened at position %d", gate.text, gate.pos)}
+			}
+			return &PolicyError{Pos: tok.pos, Token: tok.text, Msg: "expected ',' or ')'"}
+		}
+	}
+
+	if outOf && n > count {
+		return &PolicyError{Pos: gate.pos, Token: gate.text, Msg: fmt.Sprintf("requires %d signatures but only %d sub-policies given", n, count)}
+	}
+	return nil
+}
+
+// CollectionConfig 私有数据集合配置，与peer cli的collections_config.json格式一致
+type CollectionConfig struct {
+	Name              string                 `json:"name"`
+	Policy            string                 `json:"policy"`
+	RequiredPeerCount int32                  `json:"requiredPeerCount"`
+	MaxPeerCount      int32                  `json:"maxPeerCount"`
+	BlockToLive       uint64                 `json:"blockToLive"`
+	MemberOnlyRead    bool                   `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool                   `json:"memberOnlyWrite"`
+	EndorsementPolicy *CollectionEndorsement `json:"endorsementPolicy,omitempty"`
+}
+
+// CollectionEndorsement 集合级别的背书策略
+type CollectionEndorsement struct {
+	SignaturePolicy     string `json:"signaturePolicy,omitempty"`
+	ChannelConfigPolicy string `json:"channelConfigPolicy,omitempty"`
+}
+
+// ParseCollectionConfig 将集合配置JSON转换为CollectionConfig，为空时返回nil
+func ParseCollectionConfig(collConfig string) ([]*pb.CollectionConfig, error) {
+	if strings.TrimSpace(collConfig) == "" {
+		return nil, nil
+	}
+
+	configs := make([]*CollectionConfig, 0)
+	if err := json.Unmarshal([]byte(collConfig), &configs); err != nil {
+		return nil, fmt.Errorf("invalid collection config: %v", err)
+	}
+
+	collections := make([]*pb.CollectionConfig, 0, len(configs))
+	names := make(map[string]bool, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("invalid collection config: collection %d has no name", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("invalid collection config: duplicate collection %s", config.Name)
+		}
+		names[config.Name] = true
+
+		if config.Policy == "" {
+			return nil, fmt.Errorf("invalid collection config: collection %s has no policy", config.Name)
+		}
+		if config.MaxPeerCount < config.RequiredPeerCount {
+			return nil, fmt.Errorf("invalid collection config: collection %s maxPeerCount %d is less than requiredPeerCount %d", config.Name, config.MaxPeerCount, config.RequiredPeerCount)
+		}
+		policy, err := ParsePolicy(config.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy of collection %s: %v", config.Name, err)
+		}
+
+		var endorsement *pb.ApplicationPolicy
+		if ep := config.EndorsementPolicy; ep != nil {
+			switch {
+			case ep.SignaturePolicy != "" && ep.ChannelConfigPolicy != "":
+				return nil, fmt.Errorf("invalid endorsement policy of collection %s: signaturePolicy and channelConfigPolicy are exclusive", config.Name)
+			case ep.SignaturePolicy != "":
+				signaturePolicy, err := ParsePolicy(ep.SignaturePolicy)
+				if err != nil {
+					return nil, fmt.Errorf("invalid endorsement policy of collection %s: %v", config.Name, err)
+				}
+				endorsement = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_SignaturePolicy{SignaturePolicy: signaturePolicy}}
+			case ep.ChannelConfigPolicy != "":
+				endorsement = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: ep.ChannelConfigPolicy}}
+			}
+		}
+
+		collections = append(collections, &pb.CollectionConfig{
+			Payload: &pb.CollectionConfig_StaticCollectionConfig{
+				StaticCollectionConfig: &pb.StaticCollectionConfig{
+					Name: config.Name,
+					MemberOrgsPolicy: &pb.CollectionPolicyConfig{
+						Payload: &pb.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: policy},
+					},
+					RequiredPeerCount: config.RequiredPeerCount,
+					MaximumPeerCount:  config.MaxPeerCount,
+					BlockToLive:       config.BlockToLive,
+					MemberOnlyRead:    config.MemberOnlyRead,
+					MemberOnlyWrite:   config.MemberOnlyWrite,
+					EndorsementPolicy: endorsement,
+				},
+			},
+		})
+	}
+
+	return collections, nil
+}
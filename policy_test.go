@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTokenizePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		kinds  []int
+		texts  []string
+		errPos int
+	}{
+		{
+			policy: "OR('Org1MSP.member', 2)",
+			kinds:  []int{tokenIdent, tokenLParen, tokenString, tokenComma, tokenNumber, tokenRParen, tokenEOF},
+			texts:  []string{"OR", "(", "Org1MSP.member", ",", "2", ")", ""},
+		},
+		{
+			policy: `AND("Org1MSP.peer")`,
+			kinds:  []int{tokenIdent, tokenLParen, tokenString, tokenRParen, tokenEOF},
+			texts:  []string{"AND", "(", "Org1MSP.peer", ")", ""},
+		},
+		{policy: "OR('Org1MSP.member", errPos: 3},
+		{policy: "OR('Org1MSP.member'; 'Org2MSP.member')", errPos: 19},
+	}
+
+	for _, test := range tests {
+		tokens, err := tokenizePolicy(test.policy)
+		if test.kinds == nil {
+			policyErr, ok := err.(*PolicyError)
+			if !ok {
+				t.Errorf("%s: expected PolicyError, got %v", test.policy, err)
+				continue
+			}
+			if policyErr.Pos != test.errPos {
+				t.Errorf("%s: expected error at %d, got %d", test.policy, test.errPos, policyErr.Pos)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.policy, err)
+			continue
+		}
+		if len(tokens) != len(test.kinds) {
+			t.Errorf("%s: expected %d tokens, got %d", test.policy, len(test.kinds), len(tokens))
+			continue
+		}
+		for i, tok := range tokens {
+			if tok.kind != test.kinds[i] || tok.text != test.texts[i] {
+				t.Errorf("%s: token %d is %d %q, expected %d %q", test.policy, i, tok.kind, tok.text, test.kinds[i], test.texts[i])
+			}
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		// errPos为-1时表示解析成功
+		errPos int
+	}{
+		{"", -1},
+		{"'Org1MSP.member'", 0},
+		{"OR('Org1MSP.member', AND('Org2MSP.peer','Org3MSP.admin'))", -1},
+		{"and('Org1MSP.member', 'Org2MSP.member')", -1},
+		{"Or('Org1MSP.member')", -1},
+		{"OutOf(1, 'Org1MSP.member', 'Org2MSP.member')", -1},
+		{"OUTOF(2, 'Org1MSP.member', 'Org2MSP.member')", -1},
+		{"outof(1, 'Org1MSP.client')", -1},
+		{"oR('Org1MSP.member')", 0},
+		{"Outof(1, 'Org1MSP.member')", 0},
+		{"XOR('Org1MSP.member')", 0},
+		{"OR('Org1MSP.boss')", 3},
+		{"OR('Org1MSP.member' 'Org2MSP.member')", 20},
+		{"OR('Org1MSP.member',", 20},
+		{"OR('Org1MSP.member'", 19},
+		{"OutOf('Org1MSP.member')", 6},
+		{"OutOf(3, 'Org1MSP.member', 'Org2MSP.member')", 0},
+		{"OR('Org1MSP.member') 'Org2MSP.member'", 21},
+	}
+
+	for _, test := range tests {
+		_, err := ParsePolicy(test.policy)
+		if test.errPos < 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.policy, err)
+			}
+			continue
+		}
+		policyErr, ok := err.(*PolicyError)
+		if !ok {
+			t.Errorf("%s: expected PolicyError, got %v", test.policy, err)
+			continue
+		}
+		if policyErr.Pos != test.errPos {
+			t.Errorf("%s: expected error at %d, got %d (%v)", test.policy, test.errPos, policyErr.Pos, policyErr)
+		}
+	}
+}
+
+func TestParseCollectionConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		count  int
+		ok     bool
+	}{
+		{"", 0, true},
+		{`[{"name":"c1","policy":"OR('Org1MSP.member')","requiredPeerCount":0,"maxPeerCount":3}]`, 1, true},
+		{`[{"name":"c1","policy":"OR('Org1MSP.member')","endorsementPolicy":{"signaturePolicy":"AND('Org1MSP.peer')"}}]`, 1, true},
+		{`[{"name":"c1","policy":"OR('Org1MSP.member')"},{"name":"c1","policy":"OR('Org1MSP.member')"}]`, 0, false},
+		{`[{"name":"c1"}]`, 0, false},
+		{`[{"name":"c1","policy":"OR('Org1MSP.member')","requiredPeerCount":2,"maxPeerCount":1}]`, 0, false},
+		{`[{"name":"c1","policy":"OR('Org1MSP.member')","endorsementPolicy":{"signaturePolicy":"x","channelConfigPolicy":"y"}}]`, 0, false},
+		{`{}`, 0, false},
+	}
+
+	for _, test := range tests {
+		collections, err := ParseCollectionConfig(test.config)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.config, test.ok, err)
+			continue
+		}
+		if len(collections) != test.count {
+			t.Errorf("%s: expected %d collections, got %d", test.config, test.count, len(collections))
+		}
+	}
+}
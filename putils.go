@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"math/big"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/peer"
@@ -110,3 +114,82 @@ func GetChaincodeProposalPayload(bytes []byte) (*peer.ChaincodeProposalPayload,
 	err := proto.Unmarshal(bytes, cpp)
 	return cpp, errors.Wrap(err, "error unmarshaling ChaincodeProposalPayload")
 }
+
+// GetMetadataFromBlock retrieves metadata at the specified index.
+func GetMetadataFromBlock(block *common.Block, index common.BlockMetadataIndex) (*common.Metadata, error) {
+	if block.Metadata == nil || len(block.Metadata.Metadata) <= int(index) {
+		return nil, errors.Errorf("no metadata at index [%s]", index)
+	}
+
+	md := &common.Metadata{}
+	err := proto.Unmarshal(block.Metadata.Metadata[index], md)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling metadata at index [%s]", index)
+	}
+	return md, nil
+}
+
+// GetLastConfigIndexFromBlock retrieves the index of the last config block as
+// encoded in the block metadata
+func GetLastConfigIndexFromBlock(block *common.Block) (uint64, error) {
+	m, err := GetMetadataFromBlock(block, common.BlockMetadataIndex_SIGNATURES)
+	if err != nil {
+		return 0, err
+	}
+	// fabric v2.x 将last config写入signatures的元数据中
+	if len(m.Value) > 0 {
+		obm := &common.OrdererBlockMetadata{}
+		if err := proto.Unmarshal(m.Value, obm); err == nil && obm.LastConfig != nil {
+			return obm.LastConfig.Index, nil
+		}
+	}
+
+	m, err = GetMetadataFromBlock(block, common.BlockMetadataIndex_LAST_CONFIG)
+	if err != nil {
+		return 0, err
+	}
+	cfg := &common.LastConfig{}
+	err = proto.Unmarshal(m.Value, cfg)
+	if err != nil {
+		return 0, errors.Wrap(err, "error unmarshaling LastConfig")
+	}
+	return cfg.Index, nil
+}
+
+type asn1Header struct {
+	Number       *big.Int
+	PreviousHash []byte
+	DataHash     []byte
+}
+
+// BlockHeaderHash returns the hash of the block header
+func BlockHeaderHash(b *common.BlockHeader) []byte {
+	asn1Header := asn1Header{
+		PreviousHash: b.PreviousHash,
+		DataHash:     b.DataHash,
+		Number:       new(big.Int).SetUint64(b.Number),
+	}
+	result, err := asn1.Marshal(asn1Header)
+	if err != nil {
+		// Errors should only arise for types which cannot be encoded, since the
+		// BlockHeader type is known a-priori to contain only encodable types, an
+		// error here is fatal and should not be propagated
+		panic(err)
+	}
+	sum := sha256.Sum256(result)
+	return sum[:]
+}
+
+// GetEnvelopeFromBlock gets an envelope from a block's Data field.
+func GetEnvelopeFromBlock(data []byte) (*common.Envelope, error) {
+	env := &common.Envelope{}
+	err := proto.Unmarshal(data, env)
+	return env, errors.Wrap(err, "error unmarshaling Envelope")
+}
+
+// GetChaincodeEvents gets the ChaincodeEvents given chaincode event bytes
+func GetChaincodeEvents(eBytes []byte) (*peer.ChaincodeEvent, error) {
+	chaincodeEvent := &peer.ChaincodeEvent{}
+	err := proto.Unmarshal(eBytes, chaincodeEvent)
+	return chaincodeEvent, errors.Wrap(err, "error unmarshaling ChaicnodeEvent")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// client auth modes of TLSConfig.ClientAuth
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// context keys set by certAuthenticator when a certificate maps directly to a fabric identity
+const (
+	ctxKeyRoles      = "restfulserver/roles"
+	ctxKeyIdentities = "restfulserver/identities"
+)
+
+// certPrincipalPrefix is prepended to the subject of a certificate mapped directly to a fabric identity
+const certPrincipalPrefix = "cert:"
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig 根据配置创建监听使用的tls.Config，未启用时返回nil
+func newTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("load tls cert failed: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if config.MinVersion != "" {
+		version, ok := tlsVersions[config.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls minVersion %s", config.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	// 只对TLS1.2及以下生效，TLS1.3的套件不可配置
+	if len(config.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range config.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure tls cipher suite %s", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	switch config.ClientAuth {
+	case "", ClientAuthNone:
+		return tlsConfig, nil
+	case ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown tls clientAuth %s", config.ClientAuth)
+	}
+
+	if len(config.ClientCAs) == 0 {
+		return nil, errors.New("tls clientCAs are required to verify client certificates")
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	for _, file := range config.ClientCAs {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read tls client ca failed: %v", err)
+		}
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("no certificate found in tls client ca %s", file)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certAuthenticator 使用已校验的tls客户端证书认证，按subject映射为rest用户或fabric身份
+type certAuthenticator struct {
+	mappings []ClientCertMapping
+}
+
+func newCertAuthenticator(config *TLSConfig) (*certAuthenticator, error) {
+	if !config.Enabled || config.ClientAuth == "" || config.ClientAuth == ClientAuthNone {
+		return nil, errors.New("auth method cert requires tls with clientAuth request or require")
+	}
+	for _, mapping := range config.ClientCerts {
+		if mapping.Subject == "" {
+			return nil, errors.New("subject of tls client cert mapping is required")
+		}
+		// 只按完整的DN匹配，仅CN相同的其他CA签发的证书不能冒用
+		if !strings.Contains(mapping.Subject, "=") {
+			return nil, fmt.Errorf("subject of tls client cert %s must be the full DN, e.g. CN=%s,OU=client,O=Org1", mapping.Subject, mapping.Subject)
+		}
+		if (mapping.User == "") == (mapping.Identity == nil) {
+			return nil, fmt.Errorf("tls client cert %s must map to either a user or an identity", mapping.Subject)
+		}
+		if mapping.User != "" && findGinUser(mapping.User) == nil {
+			return nil, fmt.Errorf("tls client cert %s maps to unknown user %s", mapping.Subject, mapping.User)
+		}
+	}
+	return &certAuthenticator{mappings: config.ClientCerts}, nil
+}
+
+func (a *certAuthenticator) Authenticate(ctx *gin.Context) (string, error) {
+	state := ctx.Request.TLS
+	// 只信任握手时已校验过证书链的客户端证书
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return "", errNoCredentials
+	}
+	cert := state.VerifiedChains[0][0]
+
+	subject := cert.Subject.String()
+	for _, mapping := range a.mappings {
+		if mapping.Subject != subject {
+			continue
+		}
+		if mapping.User != "" {
+			return mapping.User, nil
+		}
+		ctx.Set(ctxKeyIdentities, []FabricIdentity{*mapping.Identity})
+		ctx.Set(ctxKeyRoles, mapping.Roles)
+		// 加前缀以免与ginuser重名，从而获得该用户的job及订阅
+		return certPrincipalPrefix + subject, nil
+	}
+	return "", fmt.Errorf("tls client cert %s is not mapped to any user", subject)
+}
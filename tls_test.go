@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCertAuthenticate(t *testing.T) {
+	oldConfig := serverConfig
+	defer func() { serverConfig = oldConfig }()
+	serverConfig = &ServerConfig{}
+	serverConfig.GinUsers = []GinUser{{User: "user1"}}
+
+	config := &TLSConfig{
+		Enabled:    true,
+		ClientAuth: ClientAuthRequire,
+		ClientCerts: []ClientCertMapping{
+			{Subject: "CN=user1,OU=client,O=Org1", User: "user1"},
+			{Subject: "CN=monitor,OU=client,O=Org1", Identity: &FabricIdentity{OrgName: "Org1", UserName: "User1"}, Roles: []string{"reader"}},
+		},
+	}
+	auth, err := newCertAuthenticator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject pkix.Name
+		user    string
+		ok      bool
+	}{
+		{pkix.Name{CommonName: "user1", OrganizationalUnit: []string{"client"}, Organization: []string{"Org1"}}, "user1", true},
+		{pkix.Name{CommonName: "monitor", OrganizationalUnit: []string{"client"}, Organization: []string{"Org1"}}, "cert:CN=monitor,OU=client,O=Org1", true},
+		// CN相同但DN不同的证书不匹配
+		{pkix.Name{CommonName: "user1", Organization: []string{"Org2"}}, "", false},
+		{pkix.Name{CommonName: "monitor"}, "", false},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, test := range tests {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx.Request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: test.subject}}}}
+		user, err := auth.Authenticate(ctx)
+		if (err == nil) != test.ok || user != test.user {
+			t.Errorf("%s: expected user %q ok %v, got %q %v", test.subject, test.user, test.ok, user, err)
+		}
+	}
+
+	// 只配置CN的映射在启动时拒绝
+	config.ClientCerts = []ClientCertMapping{{Subject: "monitor", User: "user1"}}
+	if _, err := newCertAuthenticator(config); err == nil {
+		t.Error("expected a mapping without full DN to be rejected")
+	}
+}
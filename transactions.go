@@ -1,11 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
@@ -51,25 +60,150 @@ func decodeX509Pem(certPem []byte) (*x509.Certificate, error) {
 	return x509.ParseCertificate(block.Bytes)
 }
 
+// fabric ca将属性写入证书的扩展中
+var attrsOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// IdentityInfo is the detail of an x509 identity
+// Role is derived from the node OUs: client, peer, admin, orderer, or member when no node OU is set
+type IdentityInfo struct {
+	Subject        string            `json:"subject"`
+	Issuer         string            `json:"issuer"`
+	SerialNumber   string            `json:"serial_number"`
+	NotBefore      time.Time         `json:"not_before"`
+	NotAfter       time.Time         `json:"not_after"`
+	DNSNames       []string          `json:"dns_names,omitempty"`
+	EmailAddresses []string          `json:"email_addresses,omitempty"`
+	IPAddresses    []string          `json:"ip_addresses,omitempty"`
+	URIs           []string          `json:"uris,omitempty"`
+	OUs            []string          `json:"ous,omitempty"`
+	Role           string            `json:"role"`
+	Attributes     map[string]string `json:"attributes,omitempty"`
+}
+
+func (id *cachedIdentity) info() *IdentityInfo {
+	if id.cert == nil {
+		return nil
+	}
+	cert := id.cert
+
+	info := &IdentityInfo{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.String(),
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		OUs:            cert.Subject.OrganizationalUnit,
+		Role:           "member",
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		switch strings.ToLower(ou) {
+		case "client", "peer", "admin", "orderer":
+			info.Role = strings.ToLower(ou)
+		}
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(attrsOID) {
+			continue
+		}
+		attrs := &struct {
+			Attrs map[string]string `json:"attrs"`
+		}{}
+		if err := json.Unmarshal(ext.Value, attrs); err != nil {
+			log.Printf("unmarshal attributes of %s failed: %v", info.Subject, err)
+			break
+		}
+		info.Attributes = attrs.Attrs
+	}
+	return info
+}
+
 type Endorser struct {
-	MSP  string `json:"msp"`
-	Name string `json:"name"`
+	MSP      string        `json:"msp"`
+	Name     string        `json:"name"`
+	Identity *IdentityInfo `json:"identity,omitempty"`
 }
 
 // TransactionDetail is the detail of transaction, but not contains RW set
 type TransactionDetail struct {
-	ChannelName      string `json:"channel_name"`
-	ID               string `json:"id"`
-	Type             string `json:"type"`
-	Creator          string `json:"creator"`
-	CreatorMSP       string `json:"creator_msp"`
-	ChaincodeName    string `json:"chaincode_name"`
-	ValidationResult string `json:"validation_result"`
-	BlockNumber      uint64 `json:"block_number"`
+	ChannelName      string        `json:"channel_name"`
+	ID               string        `json:"id"`
+	Type             string        `json:"type"`
+	Creator          string        `json:"creator"`
+	CreatorMSP       string        `json:"creator_msp"`
+	CreatorIdentity  *IdentityInfo `json:"creator_identity,omitempty"`
+	ChaincodeName    string        `json:"chaincode_name"`
+	ValidationResult string        `json:"validation_result"`
+	BlockNumber      uint64        `json:"block_number"`
 	// TxNumber         int         `json:"tx_number"`
-	CreatedAt time.Time   `json:"created_at"`
-	Endorsers []*Endorser `json:"endorsers"`
-	Value     *RawValue   `json:"raw"`
+	CreatedAt time.Time       `json:"created_at"`
+	Endorsers []*Endorser     `json:"endorsers"`
+	Value     *RawValue       `json:"raw"`
+	Actions   []*ActionDetail `json:"actions,omitempty"`
+	// Config and ConfigUpdate are set only for config transactions
+	Config       *ChannelConfig      `json:"config,omitempty"`
+	ConfigUpdate *ConfigUpdateDetail `json:"config_update,omitempty"`
+	Verification *Verification       `json:"verification,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// systemNamespaces are the namespaces of system chaincodes
+var systemNamespaces = map[string]bool{
+	"lscc":       true,
+	"_lifecycle": true,
+	"cscc":       true,
+	"qscc":       true,
+	"escc":       true,
+	"vscc":       true,
+}
+
+// NsSummary is the keys read and written in a namespace
+type NsSummary struct {
+	Namespace   string   `json:"namespace"`
+	System      bool     `json:"system"`
+	ReadKeys    []string `json:"read_keys"`
+	WriteKeys   []string `json:"write_keys"`
+	Collections []string `json:"collections,omitempty"`
+}
+
+// ActionDetail is the detail of one TransactionAction
+// ChaincodeID is the invoked chaincode, CalledChaincodes are the other non-system chaincodes with a read write set
+// in this action, i.e. the chaincodes reached through chaincode-to-chaincode calls. The ledger does not record
+// the call order, so CalledChaincodes are sorted by name, and called chaincodes that touched no keys are not listed
+// RWSets is the full read write set produced by this action, set only when requested
+type ActionDetail struct {
+	Index            int               `json:"index"`
+	ChaincodeID      *peer.ChaincodeID `json:"chaincodeid"`
+	Input            []string          `json:"input"`
+	Endorsers        []*Endorser       `json:"endorsers"`
+	CalledChaincodes []string          `json:"called_chaincodes"`
+	Namespaces       []*NsSummary      `json:"namespaces"`
+	Response         *CCResponse       `json:"response,omitempty"`
+	Event            *CCEvent          `json:"event,omitempty"`
+	RWSets           []*NsRWSet        `json:"rwsets,omitempty"`
+}
+
+// CCResponse is the response returned by the chaincode
+type CCResponse struct {
+	Status  int32  `json:"status"`
+	Message string `json:"message"`
+	Payload *Value `json:"payload"`
+}
+
+// CCEvent is the event set by the chaincode
+type CCEvent struct {
+	ChaincodeID string `json:"chaincode_id"`
+	TxID        string `json:"tx_id"`
+	EventName   string `json:"event_name"`
+	Payload     *Value `json:"payload"`
 }
 
 // RawValue define the raw value stored into blockchain
@@ -78,11 +212,9 @@ type RawValue struct {
 	ChaincodeID *peer.ChaincodeID `json:"chaincodeid"`
 	Input       []string          `json:"input"`
 	IDs         []string          `json:"ids"`
-	// Writes      []*kvrwset.KVWrite `json:"writes"`
-	// Reads       []*kvrwset.KVRead  `json:"reads"`
 }
 
-func convertEnvelopeToTXDetail(txFlag int32, env *common.Envelope) (*TransactionDetail, error) {
+func convertEnvelopeToTXDetail(txFlag int32, env *common.Envelope, opts *TxDetailOptions) (*TransactionDetail, error) {
 	// log.Println(env)
 	payload, err := GetPayload(env)
 	if err != nil {
@@ -105,23 +237,57 @@ func convertEnvelopeToTXDetail(txFlag int32, env *common.Envelope) (*Transaction
 	}
 	// log.Println("After GetSignatureHeader:",shdr)
 
-	identity, err := getIdentity(shdr.Creator)
-	if err != nil {
-		return nil, err
-	}
-
 	tx := &TransactionDetail{
 		ID:               chdr.TxId,
 		Type:             common.HeaderType_name[chdr.Type],
-		CreatorMSP:       identity.mspID,
 		ValidationResult: peer.TxValidationCode_name[txFlag],
-		CreatedAt:        time.Unix(chdr.Timestamp.Seconds, int64(chdr.Timestamp.Nanos)),
+		CreatedAt:        time.Unix(chdr.GetTimestamp().GetSeconds(), int64(chdr.GetTimestamp().GetNanos())),
+	}
+
+	// genesis block的交易没有creator
+	if len(shdr.Creator) > 0 {
+		identity, err := getIdentity(shdr.Creator)
+		if err != nil {
+			return nil, err
+		}
+		tx.CreatorMSP = identity.mspID
+		if identity.cert != nil {
+			tx.Creator = identity.cert.Subject.CommonName
+		}
+		tx.CreatorIdentity = identity.info()
+	}
+
+	var actions []*parsedAction
+	switch common.HeaderType(chdr.Type) {
+	case common.HeaderType_ENDORSER_TRANSACTION:
+		actions, err = parseEndorserTransaction(tx, payload, env, opts)
+		if err != nil {
+			return nil, err
+		}
+	case common.HeaderType_CONFIG:
+		tx.Config, tx.ConfigUpdate, err = parseConfigEnvelope(payload.Data)
+		if err != nil {
+			log.Printf("parseConfigEnvelope failed: %v", err)
+			return nil, fmt.Errorf("parseConfigEnvelope failed: %v", err)
+		}
+	case common.HeaderType_CONFIG_UPDATE:
+		tx.ConfigUpdate, err = parseConfigUpdateEnvelope(payload.Data)
+		if err != nil {
+			log.Printf("parseConfigUpdateEnvelope failed: %v", err)
+			return nil, fmt.Errorf("parseConfigUpdateEnvelope failed: %v", err)
+		}
+	default:
+		// 其他类型的交易只返回交易头信息
 	}
 
-	if identity.cert != nil {
-		tx.Creator = identity.cert.Subject.CommonName
+	if opts != nil && opts.Verify && len(shdr.Creator) > 0 {
+		tx.Verification = verifyEnvelope(env, shdr.Creator, actions, opts.MSPRoots, tx.CreatedAt)
 	}
+	return tx, nil
+}
 
+// parseEndorserTransaction 解析ENDORSER_TRANSACTION的背书、输入及读写集
+func parseEndorserTransaction(tx *TransactionDetail, payload *common.Payload, env *common.Envelope, opts *TxDetailOptions) ([]*parsedAction, error) {
 	hdrExt, err := GetChaincodeHeaderExtension(payload.Header)
 	if err != nil {
 		log.Printf("GetChaincodeHeaderExtension failed: %v", err)
@@ -133,75 +299,127 @@ func convertEnvelopeToTXDetail(txFlag int32, env *common.Envelope) (*Transaction
 	}
 
 	//fetch the endorsers from the envelope
-	chaincodeProposalPayload, endorsements, chaincodeAction, err := parseChaincodeEnvelope(env)
+	actions, err := parseChaincodeEnvelope(env)
 
 	if err != nil {
 		log.Printf("parseChaincodeEnvelope failed: %v", err)
 		return nil, fmt.Errorf("parseChaincodeEnvelope failed: %v", err)
 	}
+
 	distinctEndorser := map[string]bool{}
-	for _, e := range endorsements {
-		identity, err := getIdentity(e.Endorser)
+	for i, action := range actions {
+		actionDetail := &ActionDetail{Index: i}
+
+		for _, e := range action.actionPayload.Action.Endorsements {
+			identity, err := getIdentity(e.Endorser)
+			if err != nil {
+				return nil, err
+			}
+			userName := ""
+			if identity.cert != nil {
+				userName = identity.cert.Subject.CommonName
+			}
+
+			endorser := &Endorser{MSP: identity.mspID, Name: userName, Identity: identity.info()}
+			actionDetail.Endorsers = append(actionDetail.Endorsers, endorser)
+			if _, ok := distinctEndorser[identity.mspID+":"+userName]; !ok {
+				distinctEndorser[identity.mspID+":"+userName] = true
+				tx.Endorsers = append(tx.Endorsers, endorser)
+			}
+		}
+
+		// log.Println("Chaincode Input:", chaincodeProposalPayload.Input)
+		cis := &peer.ChaincodeInvocationSpec{}
+		err = proto.Unmarshal(action.proposalPayload.Input, cis)
 		if err != nil {
 			return nil, err
 		}
-		userName := ""
-		if identity.cert != nil {
-			userName = identity.cert.Subject.CommonName
+		raw := parseChaincodeInvocationSpec(cis)
+		actionDetail.ChaincodeID = action.chaincodeAction.GetChaincodeId()
+		if actionDetail.ChaincodeID == nil {
+			actionDetail.ChaincodeID = raw.ChaincodeID
 		}
+		actionDetail.Input = raw.Input
 
-		if _, ok := distinctEndorser[identity.mspID+":"+userName]; !ok {
-			tx.Endorsers = append(tx.Endorsers, &Endorser{MSP: identity.mspID, Name: userName})
+		actionDetail.Namespaces, err = parseNamespaces(action.chaincodeAction)
+		if err != nil {
+			return nil, err
 		}
+		actionDetail.CalledChaincodes = calledChaincodes(actionDetail.ChaincodeID.GetName(), actionDetail.Namespaces)
 
+		actionDetail.Response, actionDetail.Event, err = parseResponseAndEvent(action.chaincodeAction)
+		if err != nil {
+			return nil, err
+		}
+		// 读写集属于产生它的action，多个action时不能合并
+		if opts != nil && opts.RWSet {
+			if actionDetail.RWSets, err = getRWSets(action.chaincodeAction); err != nil {
+				return nil, err
+			}
+		}
+		tx.Actions = append(tx.Actions, actionDetail)
+
+		// 兼容原有字段，raw取第一个action
+		if i == 0 {
+			tx.Value = raw
+			keys, err := parseChaincodeAction(action.chaincodeAction, tx.ChaincodeName)
+			if err != nil {
+				return nil, err
+			}
+			tx.Value.IDs = keys
+		}
 	}
 
-	// log.Println("Chaincode Input:", chaincodeProposalPayload.Input)
-	cis := &peer.ChaincodeInvocationSpec{}
-	err = proto.Unmarshal(chaincodeProposalPayload.Input, cis)
-	if err != nil {
-		return nil, err
-	}
-	tx.Value = parseChaincodeInvocationSpec(cis)
-	keys, err := parseChaincodeAction(chaincodeAction, tx.ChaincodeName)
-	if err != nil {
-		return nil, err
-	}
-	tx.Value.IDs = keys
-	return tx, nil
+	return actions, nil
 }
 
-func parseChaincodeEnvelope(env *common.Envelope) (*peer.ChaincodeProposalPayload, []*peer.Endorsement, *peer.ChaincodeAction, error) {
+// parsedAction 一个TransactionAction解析后的内容
+type parsedAction struct {
+	actionPayload   *peer.ChaincodeActionPayload
+	proposalPayload *peer.ChaincodeProposalPayload
+	chaincodeAction *peer.ChaincodeAction
+}
+
+func parseChaincodeEnvelope(env *common.Envelope) ([]*parsedAction, error) {
 	payl, err := GetPayload(env)
 	if err != nil {
 		log.Println(err.Error())
-		return nil, nil, nil, err
+		return nil, err
 	}
 
 	tx, err := GetTransaction(payl.Data)
 	if err != nil {
 		log.Println(err.Error())
-		return nil, nil, nil, err
+		return nil, err
 	}
 
 	if len(tx.Actions) == 0 {
 		log.Println("At least one TransactionAction is required")
-		return nil, nil, nil, fmt.Errorf("At least one TransactionAction is required")
+		return nil, fmt.Errorf("At least one TransactionAction is required")
 	}
 
-	actionPayload, chaincodeAction, err := GetPayloads(tx.Actions[0])
-	if err != nil {
-		log.Println(err.Error())
-		return nil, nil, nil, err
-	}
+	actions := make([]*parsedAction, 0, len(tx.Actions))
+	for _, txAction := range tx.Actions {
+		actionPayload, chaincodeAction, err := GetPayloads(txAction)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
 
-	chaincodeProposalPayload, err := GetChaincodeProposalPayload(actionPayload.ChaincodeProposalPayload)
-	if err != nil {
-		log.Println(err.Error())
-		return nil, nil, nil, err
+		chaincodeProposalPayload, err := GetChaincodeProposalPayload(actionPayload.ChaincodeProposalPayload)
+		if err != nil {
+			log.Println(err.Error())
+			return nil, err
+		}
+
+		actions = append(actions, &parsedAction{
+			actionPayload:   actionPayload,
+			proposalPayload: chaincodeProposalPayload,
+			chaincodeAction: chaincodeAction,
+		})
 	}
 
-	return chaincodeProposalPayload, actionPayload.Action.Endorsements, chaincodeAction, nil
+	return actions, nil
 }
 
 func parseChaincodeInvocationSpec(cis *peer.ChaincodeInvocationSpec) *RawValue {
@@ -254,21 +472,237 @@ func parseChaincodeAction(action *peer.ChaincodeAction, chaincodename string) ([
 	return keys, nil
 }
 
+// parseNamespaces 解析action中所有namespace读写的key
+func parseNamespaces(action *peer.ChaincodeAction) ([]*NsSummary, error) {
+	txRWSet := &rwset.TxReadWriteSet{}
+	err := proto.Unmarshal(action.GetResults(), txRWSet)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*NsSummary, 0, len(txRWSet.NsRwset))
+	for _, nsRWSet := range txRWSet.NsRwset {
+		kvRWSet := &kvrwset.KVRWSet{}
+		err = proto.Unmarshal(nsRWSet.Rwset, kvRWSet)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := &NsSummary{
+			Namespace: nsRWSet.Namespace,
+			System:    systemNamespaces[nsRWSet.Namespace],
+			ReadKeys:  make([]string, 0, len(kvRWSet.Reads)),
+			WriteKeys: make([]string, 0, len(kvRWSet.Writes)),
+		}
+		for _, read := range kvRWSet.Reads {
+			summary.ReadKeys = append(summary.ReadKeys, read.Key)
+		}
+		for _, write := range kvRWSet.Writes {
+			summary.WriteKeys = append(summary.WriteKeys, write.Key)
+		}
+		for _, coll := range nsRWSet.CollectionHashedRwset {
+			summary.Collections = append(summary.Collections, coll.CollectionName)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// parseResponseAndEvent 解析chaincode的返回值及事件，未设置事件时event为nil
+func parseResponseAndEvent(action *peer.ChaincodeAction) (*CCResponse, *CCEvent, error) {
+	var response *CCResponse
+	if resp := action.GetResponse(); resp != nil {
+		response = &CCResponse{
+			Status:  resp.Status,
+			Message: resp.Message,
+			Payload: renderValue(resp.Payload),
+		}
+	}
+
+	if len(action.GetEvents()) == 0 {
+		return response, nil, nil
+	}
+	ccEvent, err := GetChaincodeEvents(action.GetEvents())
+	if err != nil {
+		return nil, nil, err
+	}
+	event := &CCEvent{
+		ChaincodeID: ccEvent.ChaincodeId,
+		TxID:        ccEvent.TxId,
+		EventName:   ccEvent.EventName,
+		Payload:     renderValue(ccEvent.Payload),
+	}
+	return response, event, nil
+}
+
+// calledChaincodes 读写集中出现的、被调用chaincode以外的非系统chaincode，按名称排序
+func calledChaincodes(invoked string, namespaces []*NsSummary) []string {
+	called := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if !ns.System && ns.Namespace != invoked {
+			called = append(called, ns.Namespace)
+		}
+	}
+	sort.Strings(called)
+	return called
+}
+
+// TxDetailOptions 控制交易详情中需要额外解析的内容
+type TxDetailOptions struct {
+	// RWSet 是否返回完整的读写集
+	RWSet bool
+	// Verify 是否校验creator及背书签名
+	Verify bool
+	// MSPRoots 不为空时同时校验证书链，key为MSPID
+	MSPRoots map[string]*MSPRoots
+}
+
+// value encodings of Value
+const (
+	ValueEncodingUTF8   = "utf8"
+	ValueEncodingJSON   = "json"
+	ValueEncodingBase64 = "base64"
+)
+
+// Value is a state value rendered according to its content
+type Value struct {
+	Encoding string      `json:"encoding"`
+	Data     interface{} `json:"data"`
+}
+
+// KVVersion is the version of a read key
+type KVVersion struct {
+	BlockNum uint64 `json:"block_num"`
+	TxNum    uint64 `json:"tx_num"`
+}
+
+// KVRead is a key read by the transaction, Version is nil if the key did not exist
+type KVRead struct {
+	Key     string     `json:"key"`
+	Version *KVVersion `json:"version"`
+}
+
+// KVWrite is a key written by the transaction
+type KVWrite struct {
+	Key      string `json:"key"`
+	IsDelete bool   `json:"is_delete"`
+	Value    *Value `json:"value,omitempty"`
+}
+
+// RangeQuery is a range query executed by the transaction
+type RangeQuery struct {
+	StartKey     string    `json:"start_key"`
+	EndKey       string    `json:"end_key"`
+	ItrExhausted bool      `json:"itr_exhausted"`
+	Reads        []*KVRead `json:"reads,omitempty"`
+	MerkleHashes []string  `json:"merkle_hashes,omitempty"`
+}
+
+// KVMetadataWrite is a metadata write of a key
+type KVMetadataWrite struct {
+	Key     string            `json:"key"`
+	Entries map[string]*Value `json:"entries"`
+}
+
+// NsRWSet is the full read write set of a namespace
+type NsRWSet struct {
+	Namespace      string             `json:"namespace"`
+	Reads          []*KVRead          `json:"reads"`
+	Writes         []*KVWrite         `json:"writes"`
+	RangeQueries   []*RangeQuery      `json:"range_queries,omitempty"`
+	MetadataWrites []*KVMetadataWrite `json:"metadata_writes,omitempty"`
+}
+
+// renderValue 根据内容将值渲染为JSON、UTF-8字符串或base64
+func renderValue(value []byte) *Value {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return &Value{Encoding: ValueEncodingJSON, Data: json.RawMessage(trimmed)}
+	}
+	if utf8.Valid(value) && isPrintable(string(value)) {
+		return &Value{Encoding: ValueEncodingUTF8, Data: string(value)}
+	}
+	return &Value{Encoding: ValueEncodingBase64, Data: base64.StdEncoding.EncodeToString(value)}
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func convertKVReads(reads []*kvrwset.KVRead) []*KVRead {
+	result := make([]*KVRead, 0, len(reads))
+	for _, read := range reads {
+		r := &KVRead{Key: read.Key}
+		if read.Version != nil {
+			r.Version = &KVVersion{BlockNum: read.Version.BlockNum, TxNum: read.Version.TxNum}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func convertKVRWSet(namespace string, kvRWSet *kvrwset.KVRWSet) *NsRWSet {
+	nsRWSet := &NsRWSet{
+		Namespace: namespace,
+		Reads:     convertKVReads(kvRWSet.Reads),
+		Writes:    make([]*KVWrite, 0, len(kvRWSet.Writes)),
+	}
+
+	for _, write := range kvRWSet.Writes {
+		w := &KVWrite{Key: write.Key, IsDelete: write.IsDelete}
+		if !write.IsDelete {
+			w.Value = renderValue(write.Value)
+		}
+		nsRWSet.Writes = append(nsRWSet.Writes, w)
+	}
+
+	for _, rqi := range kvRWSet.RangeQueriesInfo {
+		rq := &RangeQuery{StartKey: rqi.StartKey, EndKey: rqi.EndKey, ItrExhausted: rqi.ItrExhausted}
+		if rawReads := rqi.GetRawReads(); rawReads != nil {
+			rq.Reads = convertKVReads(rawReads.KvReads)
+		}
+		if summary := rqi.GetReadsMerkleHashes(); summary != nil {
+			for _, hash := range summary.MaxLevelHashes {
+				rq.MerkleHashes = append(rq.MerkleHashes, hex.EncodeToString(hash))
+			}
+		}
+		nsRWSet.RangeQueries = append(nsRWSet.RangeQueries, rq)
+	}
+
+	for _, mw := range kvRWSet.MetadataWrites {
+		m := &KVMetadataWrite{Key: mw.Key, Entries: make(map[string]*Value, len(mw.Entries))}
+		for _, entry := range mw.Entries {
+			m.Entries[entry.Name] = renderValue(entry.Value)
+		}
+		nsRWSet.MetadataWrites = append(nsRWSet.MetadataWrites, m)
+	}
+
+	return nsRWSet
+}
+
 // 获取完整的读写集
-func getRWSets(action *peer.ChaincodeAction) ([]*kvrwset.KVWrite, []*kvrwset.KVRead, error) {
+func getRWSets(action *peer.ChaincodeAction) ([]*NsRWSet, error) {
 	resultBytes := action.GetResults()
 
 	txRWSet := &rwset.TxReadWriteSet{}
 	err := proto.Unmarshal(resultBytes, txRWSet)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	kvRwSetByte := txRWSet.NsRwset[0].Rwset
-	kvRWSet := &kvrwset.KVRWSet{}
-	err = proto.Unmarshal(kvRwSetByte, kvRWSet)
-	if err != nil {
-		return nil, nil, err
+	nsRWSets := make([]*NsRWSet, 0, len(txRWSet.NsRwset))
+	for _, nsRWSet := range txRWSet.NsRwset {
+		kvRWSet := &kvrwset.KVRWSet{}
+		err = proto.Unmarshal(nsRWSet.Rwset, kvRWSet)
+		if err != nil {
+			return nil, err
+		}
+		nsRWSets = append(nsRWSets, convertKVRWSet(nsRWSet.Namespace, kvRWSet))
 	}
-	return kvRWSet.Writes, kvRWSet.Reads, nil
+	return nsRWSets, nil
 }
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func mustMarshal(t *testing.T, msg proto.Message) []byte {
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// testAction 构造交易中的一个action
+type testAction struct {
+	chaincode    string
+	args         []string
+	nsRWSets     []*rwset.NsReadWriteSet
+	event        *peer.ChaincodeEvent
+	response     *peer.Response
+	endorsements []*peer.Endorsement
+}
+
+func testNsRWSet(t *testing.T, namespace string, kvRWSet *kvrwset.KVRWSet) *rwset.NsReadWriteSet {
+	return &rwset.NsReadWriteSet{Namespace: namespace, Rwset: mustMarshal(t, kvRWSet)}
+}
+
+// testTransactionAction 返回action及其ProposalResponsePayload，背书签名的内容为ProposalResponsePayload加背书者身份
+func testTransactionAction(t *testing.T, action *testAction) (*peer.TransactionAction, []byte) {
+	ccAction := &peer.ChaincodeAction{
+		Results:     mustMarshal(t, &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV, NsRwset: action.nsRWSets}),
+		Response:    action.response,
+		ChaincodeId: &peer.ChaincodeID{Name: action.chaincode, Version: "1.0"},
+	}
+	if action.event != nil {
+		ccAction.Events = mustMarshal(t, action.event)
+	}
+	prp := mustMarshal(t, &peer.ProposalResponsePayload{ProposalHash: []byte("proposal"), Extension: mustMarshal(t, ccAction)})
+
+	args := make([][]byte, 0, len(action.args))
+	for _, arg := range action.args {
+		args = append(args, []byte(arg))
+	}
+	cis := &peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: action.chaincode},
+		Input:       &peer.ChaincodeInput{Args: args},
+	}}
+	payload := &peer.ChaincodeActionPayload{
+		ChaincodeProposalPayload: mustMarshal(t, &peer.ChaincodeProposalPayload{Input: mustMarshal(t, cis)}),
+		Action:                   &peer.ChaincodeEndorsedAction{ProposalResponsePayload: prp, Endorsements: action.endorsements},
+	}
+	return &peer.TransactionAction{Header: mustMarshal(t, &common.SignatureHeader{}), Payload: mustMarshal(t, payload)}, prp
+}
+
+// testChannelHeader 返回序列化的通道头，交易时间固定
+func testChannelHeader(t *testing.T, headerType common.HeaderType, txID string, extension []byte) []byte {
+	return mustMarshal(t, &common.ChannelHeader{
+		Type:      int32(headerType),
+		ChannelId: "mychannel",
+		TxId:      txID,
+		Timestamp: &timestamp.Timestamp{Seconds: testTxTime.Unix()},
+		Extension: extension,
+	})
+}
+
+var testTxTime = time.Date(2020, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// testEndorserEnvelope 构造未签名的ENDORSER_TRANSACTION，creator为空时不解析创建者
+func testEndorserEnvelope(t *testing.T, txID string, creator []byte, actions ...*testAction) *common.Envelope {
+	tx := &peer.Transaction{}
+	for _, action := range actions {
+		txAction, _ := testTransactionAction(t, action)
+		tx.Actions = append(tx.Actions, txAction)
+	}
+	extension := mustMarshal(t, &peer.ChaincodeHeaderExtension{ChaincodeId: &peer.ChaincodeID{Name: actions[0].chaincode}})
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   testChannelHeader(t, common.HeaderType_ENDORSER_TRANSACTION, txID, extension),
+			SignatureHeader: mustMarshal(t, &common.SignatureHeader{Creator: creator, Nonce: []byte("nonce")}),
+		},
+		Data: mustMarshal(t, tx),
+	}
+	return &common.Envelope{Payload: mustMarshal(t, payload)}
+}
+
+func TestRenderValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		encoding string
+		data     string
+	}{
+		{"red", ValueEncodingUTF8, `"red"`},
+		{"", ValueEncodingUTF8, `""`},
+		{"多行\n文本", ValueEncodingUTF8, `"多行\n文本"`},
+		{`{"make":"Toyota","owner":"Tom"}`, ValueEncodingJSON, `{"make":"Toyota","owner":"Tom"}`},
+		{"  [1, 2]\n", ValueEncodingJSON, `[1,2]`},
+		// 数字及字符串虽是合法JSON，仍按文本返回
+		{"42", ValueEncodingUTF8, `"42"`},
+		{`{"make":`, ValueEncodingUTF8, `"{\"make\":"`},
+		{"\x00\x01\xff", ValueEncodingBase64, `"AAH/"`},
+		{"bell\x07", ValueEncodingBase64, `"YmVsbAc="`},
+	}
+
+	for _, test := range tests {
+		value := renderValue([]byte(test.value))
+		data, err := json.Marshal(value.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Encoding != test.encoding || string(data) != test.data {
+			t.Errorf("%q: expected %s %s, got %s %s", test.value, test.encoding, test.data, value.Encoding, data)
+		}
+	}
+}
+
+func TestConvertKVRWSet(t *testing.T) {
+	kvRWSet := &kvrwset.KVRWSet{
+		Reads: []*kvrwset.KVRead{
+			{Key: "CAR0", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}},
+			{Key: "CAR9"},
+		},
+		RangeQueriesInfo: []*kvrwset.RangeQueryInfo{
+			{
+				StartKey:     "CAR0",
+				EndKey:       "CAR2",
+				ItrExhausted: true,
+				ReadsInfo: &kvrwset.RangeQueryInfo_RawReads{RawReads: &kvrwset.QueryReads{KvReads: []*kvrwset.KVRead{
+					{Key: "CAR0", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}},
+					{Key: "CAR1", Version: &kvrwset.Version{BlockNum: 4}},
+				}}},
+			},
+			{
+				StartKey:  "CAR2",
+				EndKey:    "CAR9",
+				ReadsInfo: &kvrwset.RangeQueryInfo_ReadsMerkleHashes{ReadsMerkleHashes: &kvrwset.QueryReadsMerkleSummary{MaxLevelHashes: [][]byte{{0xab, 0xcd}}}},
+			},
+		},
+		Writes: []*kvrwset.KVWrite{
+			{Key: "CAR0", Value: []byte(`{"make":"Toyota"}`)},
+			{Key: "CAR1", Value: []byte("blue")},
+			{Key: "CAR2", Value: []byte{0xff, 0x00}},
+			{Key: "CAR3", IsDelete: true},
+		},
+		MetadataWrites: []*kvrwset.KVMetadataWrite{
+			{Key: "CAR0", Entries: []*kvrwset.KVMetadataEntry{{Name: "VALIDATION_PARAMETER", Value: []byte{0x0a, 0x01}}}},
+		},
+	}
+
+	buf, err := json.Marshal(convertKVRWSet("fabcar", kvRWSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"namespace":"fabcar",` +
+		`"reads":[{"key":"CAR0","version":{"block_num":3,"tx_num":1}},{"key":"CAR9","version":null}],` +
+		`"writes":[{"key":"CAR0","is_delete":false,"value":{"encoding":"json","data":{"make":"Toyota"}}},` +
+		`{"key":"CAR1","is_delete":false,"value":{"encoding":"utf8","data":"blue"}},` +
+		`{"key":"CAR2","is_delete":false,"value":{"encoding":"base64","data":"/wA="}},` +
+		`{"key":"CAR3","is_delete":true}],` +
+		`"range_queries":[{"start_key":"CAR0","end_key":"CAR2","itr_exhausted":true,"reads":[{"key":"CAR0","version":{"block_num":3,"tx_num":1}},{"key":"CAR1","version":{"block_num":4,"tx_num":0}}]},` +
+		`{"start_key":"CAR2","end_key":"CAR9","itr_exhausted":false,"merkle_hashes":["abcd"]}],` +
+		`"metadata_writes":[{"key":"CAR0","entries":{"VALIDATION_PARAMETER":{"encoding":"base64","data":"CgE="}}}]}`
+	if string(buf) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf)
+	}
+}
+
+// TestActionRWSets 多个action的读写集分别属于各自的action
+func TestActionRWSets(t *testing.T) {
+	env := testEndorserEnvelope(t, "tx1", nil,
+		&testAction{
+			chaincode: "fabcar",
+			args:      []string{"changeCarOwner", "CAR0", "Dave"},
+			nsRWSets: []*rwset.NsReadWriteSet{
+				testNsRWSet(t, "fabcar", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "CAR0", Value: []byte("Dave")}}}),
+				testNsRWSet(t, "lscc", &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "fabcar"}}}),
+			},
+		},
+		&testAction{
+			chaincode: "marbles",
+			args:      []string{"delete", "marble1"},
+			nsRWSets: []*rwset.NsReadWriteSet{
+				testNsRWSet(t, "marbles", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "marble1", IsDelete: true}}}),
+			},
+		},
+	)
+
+	tx, err := convertEnvelopeToTXDetail(int32(peer.TxValidationCode_VALID), env, &TxDetailOptions{RWSet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Actions) != 2 {
+		t.Fatalf("expected 2 actions, got %d", len(tx.Actions))
+	}
+	namespaces := func(action *ActionDetail) []string {
+		var names []string
+		for _, nsRWSet := range action.RWSets {
+			names = append(names, nsRWSet.Namespace)
+		}
+		return names
+	}
+	if names := namespaces(tx.Actions[0]); len(names) != 2 || names[0] != "fabcar" || names[1] != "lscc" {
+		t.Errorf("unexpected rwsets of action 0: %v", names)
+	}
+	if names := namespaces(tx.Actions[1]); len(names) != 1 || names[0] != "marbles" || !tx.Actions[1].RWSets[0].Writes[0].IsDelete {
+		t.Errorf("unexpected rwsets of action 1: %v", names)
+	}
+
+	// 未要求时不返回读写集
+	tx, err = convertEnvelopeToTXDetail(int32(peer.TxValidationCode_VALID), env, &TxDetailOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Actions[0].RWSets != nil || tx.Actions[1].RWSets != nil {
+		t.Error("expected no rwsets unless requested")
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	nsRWSets := []*rwset.NsReadWriteSet{
+		testNsRWSet(t, "fabcar", &kvrwset.KVRWSet{
+			Reads:  []*kvrwset.KVRead{{Key: "CAR0"}, {Key: "CAR1"}},
+			Writes: []*kvrwset.KVWrite{{Key: "CAR0", Value: []byte("Dave")}},
+		}),
+		testNsRWSet(t, "lscc", &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "fabcar"}}}),
+		testNsRWSet(t, "token", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "Dave", IsDelete: true}}}),
+	}
+	private := testNsRWSet(t, "marbles", &kvrwset.KVRWSet{})
+	private.CollectionHashedRwset = []*rwset.CollectionHashedReadWriteSet{{CollectionName: "collectionMarbles"}}
+	nsRWSets = append(nsRWSets, private)
+
+	action := &peer.ChaincodeAction{Results: mustMarshal(t, &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV, NsRwset: nsRWSets})}
+	summaries, err := parseNamespaces(action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(summaries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"namespace":"fabcar","system":false,"read_keys":["CAR0","CAR1"],"write_keys":["CAR0"]},` +
+		`{"namespace":"lscc","system":true,"read_keys":["fabcar"],"write_keys":[]},` +
+		`{"namespace":"token","system":false,"read_keys":[],"write_keys":["Dave"]},` +
+		`{"namespace":"marbles","system":false,"read_keys":[],"write_keys":[],"collections":["collectionMarbles"]}]`
+	if string(buf) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf)
+	}
+
+	tests := []struct {
+		invoked string
+		called  []string
+	}{
+		{"fabcar", []string{"marbles", "token"}},
+		{"token", []string{"fabcar", "marbles"}},
+		// 系统chaincode不作为被调用的chaincode
+		{"lscc", []string{"fabcar", "marbles", "token"}},
+	}
+	for _, test := range tests {
+		called := calledChaincodes(test.invoked, summaries)
+		if strings.Join(called, ",") != strings.Join(test.called, ",") {
+			t.Errorf("%s: expected called chaincodes %v, got %v", test.invoked, test.called, called)
+		}
+	}
+
+	// 无法解析的读写集
+	if _, err := parseNamespaces(&peer.ChaincodeAction{Results: []byte{0xff}}); err == nil {
+		t.Error("expected invalid results to be rejected")
+	}
+	if _, err := parseNamespaces(&peer.ChaincodeAction{Results: mustMarshal(t, &rwset.TxReadWriteSet{
+		NsRwset: []*rwset.NsReadWriteSet{{Namespace: "fabcar", Rwset: []byte{0xff}}},
+	})}); err == nil {
+		t.Error("expected an invalid namespace rwset to be rejected")
+	}
+}
+
+func TestParseResponseAndEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   *peer.ChaincodeAction
+		response string
+		event    string
+		err      bool
+	}{
+		{
+			name:     "response only",
+			action:   &peer.ChaincodeAction{Response: &peer.Response{Status: 200, Payload: []byte(`{"owner":"Dave"}`)}},
+			response: `{"status":200,"message":"","payload":{"encoding":"json","data":{"owner":"Dave"}}}`,
+			event:    `null`,
+		},
+		{
+			name: "response and event",
+			action: &peer.ChaincodeAction{
+				Response: &peer.Response{Status: 500, Message: "car not found"},
+				Events: mustMarshal(t, &peer.ChaincodeEvent{
+					ChaincodeId: "fabcar", TxId: "tx1", EventName: "changeOwner", Payload: []byte{0x00, 0x01},
+				}),
+			},
+			response: `{"status":500,"message":"car not found","payload":{"encoding":"utf8","data":""}}`,
+			event:    `{"chaincode_id":"fabcar","tx_id":"tx1","event_name":"changeOwner","payload":{"encoding":"base64","data":"AAE="}}`,
+		},
+		{
+			name:     "nothing set",
+			action:   &peer.ChaincodeAction{},
+			response: `null`,
+			event:    `null`,
+		},
+		{
+			name:   "invalid event",
+			action: &peer.ChaincodeAction{Events: []byte{0xff}},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		response, event, err := parseResponseAndEvent(test.action)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		buf, _ := json.Marshal(response)
+		if string(buf) != test.response {
+			t.Errorf("%s: expected response %s, got %s", test.name, test.response, buf)
+		}
+		buf, _ = json.Marshal(event)
+		if string(buf) != test.event {
+			t.Errorf("%s: expected event %s, got %s", test.name, test.event, buf)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+)
+
+// MSPRoots is the root and intermediate certificates of an MSP in the channel
+type MSPRoots struct {
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+}
+
+// SignatureCheck is the verification result of a signature
+// ChainValid is nil when the certificate chain is not checked
+// Error is set when the identity cannot be decoded, SignatureError and ChainError report each check separately
+type SignatureCheck struct {
+	Action         int    `json:"action"`
+	MSP            string `json:"msp"`
+	Name           string `json:"name"`
+	SignatureValid bool   `json:"signature_valid"`
+	SignatureError string `json:"signature_error,omitempty"`
+	ChainValid     *bool  `json:"chain_valid,omitempty"`
+	ChainError     string `json:"chain_error,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Verification is the verification result of the creator and endorsement signatures
+type Verification struct {
+	Valid        bool              `json:"valid"`
+	Creator      *SignatureCheck   `json:"creator"`
+	Endorsements []*SignatureCheck `json:"endorsements"`
+}
+
+func (v *Verification) add(check *SignatureCheck) {
+	v.Endorsements = append(v.Endorsements, check)
+	v.Valid = v.Valid && check.valid()
+}
+
+func (c *SignatureCheck) valid() bool {
+	return c.SignatureValid && (c.ChainValid == nil || *c.ChainValid)
+}
+
+// buildMSPRoots 根据通道配置中的MSP构建各MSP的证书池
+func buildMSPRoots(msps []*mspproto.MSPConfig) (map[string]*MSPRoots, error) {
+	roots := make(map[string]*MSPRoots, len(msps))
+	for _, mspConfig := range msps {
+		// 只处理x509类型的MSP
+		if mspConfig.Type != 0 {
+			continue
+		}
+		fabricConfig := &mspproto.FabricMSPConfig{}
+		if err := proto.Unmarshal(mspConfig.Config, fabricConfig); err != nil {
+			return nil, fmt.Errorf("error unmarshaling FabricMSPConfig: %v", err)
+		}
+
+		mspRoots := &MSPRoots{Roots: x509.NewCertPool(), Intermediates: x509.NewCertPool()}
+		for _, certPem := range fabricConfig.RootCerts {
+			cert, err := decodeX509Pem(certPem)
+			if err != nil {
+				return nil, fmt.Errorf("bad root cert of %s: %v", fabricConfig.Name, err)
+			}
+			mspRoots.Roots.AddCert(cert)
+		}
+		for _, certPem := range fabricConfig.IntermediateCerts {
+			cert, err := decodeX509Pem(certPem)
+			if err != nil {
+				return nil, fmt.Errorf("bad intermediate cert of %s: %v", fabricConfig.Name, err)
+			}
+			mspRoots.Intermediates.AddCert(cert)
+		}
+		roots[fabricConfig.Name] = mspRoots
+	}
+	return roots, nil
+}
+
+// queryMSPRootsAt 构建block生效时的通道配置中各MSP的证书池，而不是当前的通道配置
+func queryMSPRootsAt(ledgerClient *ledger.Client, block *common.Block, targets []string) (map[string]*MSPRoots, error) {
+	configBlock := block
+	// genesis block本身即为配置区块
+	if number := block.GetHeader().GetNumber(); number > 0 {
+		index, err := GetLastConfigIndexFromBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if index != number {
+			if configBlock, err = ledgerClient.QueryBlock(index, ledger.WithTargetEndpoints(targets...)); err != nil {
+				return nil, fmt.Errorf("query config block %d failed: %v", index, err)
+			}
+		}
+	}
+
+	config, err := resource.ExtractConfigFromBlock(configBlock)
+	if err != nil {
+		return nil, err
+	}
+	msps, err := configMSPs(config)
+	if err != nil {
+		return nil, err
+	}
+	return buildMSPRoots(msps)
+}
+
+// configMSPs 返回通道配置中application及orderer组织的MSP配置
+func configMSPs(config *common.Config) ([]*mspproto.MSPConfig, error) {
+	msps := make([]*mspproto.MSPConfig, 0)
+	for _, groupName := range []string{groupApplication, groupOrderer} {
+		group, ok := config.GetChannelGroup().GetGroups()[groupName]
+		if !ok {
+			continue
+		}
+		for orgName, org := range group.Groups {
+			value, ok := org.Values[valueMSP]
+			if !ok {
+				continue
+			}
+			mspConfig, _, err := decodeMSPConfig(value.Value)
+			if err != nil {
+				return nil, fmt.Errorf("bad msp of %s: %v", orgName, err)
+			}
+			msps = append(msps, mspConfig)
+		}
+	}
+	return msps, nil
+}
+
+// verifySignature 使用serializedIdentity中的证书校验msg的签名
+// roots不为空时同时校验证书是否由该MSP的CA签发
+func verifySignature(serializedIdentity, msg, signature []byte, roots map[string]*MSPRoots, at time.Time) *SignatureCheck {
+	check := &SignatureCheck{}
+
+	identity, err := getIdentity(serializedIdentity)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.MSP = identity.mspID
+	check.Name = identity.cert.Subject.CommonName
+
+	// fabric默认使用SHA256摘要，ECDSA签名为ASN.1编码
+	algorithm := x509.ECDSAWithSHA256
+	if identity.cert.PublicKeyAlgorithm == x509.RSA {
+		algorithm = x509.SHA256WithRSA
+	}
+	if err := identity.cert.CheckSignature(algorithm, msg, signature); err != nil {
+		check.SignatureError = err.Error()
+	} else {
+		check.SignatureValid = true
+	}
+
+	if roots == nil {
+		return check
+	}
+	chainValid := false
+	check.ChainValid = &chainValid
+	mspRoots, ok := roots[identity.mspID]
+	if !ok {
+		check.ChainError = fmt.Sprintf("msp %s is not a member of the channel", identity.mspID)
+		return check
+	}
+	_, err = identity.cert.Verify(x509.VerifyOptions{
+		Roots:         mspRoots.Roots,
+		Intermediates: mspRoots.Intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		check.ChainError = err.Error()
+		return check
+	}
+	chainValid = true
+	return check
+}
+
+// verifyEnvelope 校验交易的creator签名以及每个action的背书签名
+func verifyEnvelope(env *common.Envelope, creator []byte, actions []*parsedAction, roots map[string]*MSPRoots, at time.Time) *Verification {
+	verification := &Verification{Valid: true}
+
+	verification.Creator = verifySignature(creator, env.Payload, env.Signature, roots, at)
+	verification.Valid = verification.Creator.valid()
+
+	for i, action := range actions {
+		prpBytes := action.actionPayload.Action.ProposalResponsePayload
+		for _, endorsement := range action.actionPayload.Action.Endorsements {
+			// 背书签名的内容为 proposal response payload + endorser
+			msg := make([]byte, 0, len(prpBytes)+len(endorsement.Endorser))
+			msg = append(msg, prpBytes...)
+			msg = append(msg, endorsement.Endorser...)
+
+			check := verifySignature(endorsement.Endorser, msg, endorsement.Signature, roots, at)
+			check.Action = i
+			verification.add(check)
+		}
+	}
+	return verification
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testCA 一个MSP的根CA
+type testCA struct {
+	mspID string
+	key   *ecdsa.PrivateKey
+	cert  *x509.Certificate
+	pem   []byte
+}
+
+// testSigner CA签发的身份，identity为序列化的SerializedIdentity
+type testSigner struct {
+	key      *ecdsa.PrivateKey
+	identity []byte
+}
+
+func newTestCA(t *testing.T, mspID string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca." + mspID},
+		NotBefore:             testTxTime.Add(-time.Hour),
+		NotAfter:              testTxTime.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{mspID: mspID, key: key, cert: cert, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发一个leaf证书，MSPID为CA的MSPID
+func (ca *testCA) issue(t *testing.T, name string) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    testTxTime.Add(-time.Hour),
+		NotAfter:     testTxTime.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return &testSigner{key: key, identity: mustMarshal(t, &mspproto.SerializedIdentity{Mspid: ca.mspID, IdBytes: certPem})}
+}
+
+func (s *testSigner) sign(t *testing.T, msg []byte) []byte {
+	digest := sha256.Sum256(msg)
+	signature, err := s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// testMSPRoots 通过通道配置构建各CA所属MSP的证书池
+func testMSPRoots(t *testing.T, application []*testCA, orderer []*testCA) map[string]*MSPRoots {
+	group := func(cas []*testCA) *common.ConfigGroup {
+		g := &common.ConfigGroup{Groups: make(map[string]*common.ConfigGroup)}
+		for _, ca := range cas {
+			fabricConfig := &mspproto.FabricMSPConfig{Name: ca.mspID, RootCerts: [][]byte{ca.pem}}
+			value := mustMarshal(t, &mspproto.MSPConfig{Config: mustMarshal(t, fabricConfig)})
+			g.Groups[ca.mspID] = &common.ConfigGroup{Values: map[string]*common.ConfigValue{valueMSP: {Value: value}}}
+		}
+		return g
+	}
+	config := &common.Config{ChannelGroup: &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+		groupApplication: group(application),
+		groupOrderer:     group(orderer),
+	}}}
+	msps, err := configMSPs(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := buildMSPRoots(msps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return roots
+}
+
+func TestConfigMSPs(t *testing.T) {
+	roots := testMSPRoots(t, []*testCA{newTestCA(t, "Org1MSP"), newTestCA(t, "Org2MSP")}, []*testCA{newTestCA(t, "OrdererMSP")})
+	if len(roots) != 3 || roots["Org1MSP"] == nil || roots["Org2MSP"] == nil || roots["OrdererMSP"] == nil {
+		t.Errorf("unexpected msp roots %v", roots)
+	}
+
+	broken := &common.Config{ChannelGroup: &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+		groupApplication: {Groups: map[string]*common.ConfigGroup{
+			"Org1MSP": {Values: map[string]*common.ConfigValue{valueMSP: {Value: []byte{0xff}}}},
+		}},
+	}}}
+	if _, err := configMSPs(broken); err == nil || !strings.Contains(err.Error(), "Org1MSP") {
+		t.Errorf("expected an invalid msp of Org1MSP to be rejected, got %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	org1CA := newTestCA(t, "Org1MSP")
+	roots := testMSPRoots(t, []*testCA{org1CA}, []*testCA{newTestCA(t, "OrdererMSP")})
+	user := org1CA.issue(t, "User1@org1.example.com")
+	// 与Org1MSP同名但不属于通道配置的CA
+	forged := newTestCA(t, "Org1MSP").issue(t, "User1@org1.example.com")
+	stranger := newTestCA(t, "Org3MSP").issue(t, "User1@org3.example.com")
+
+	msg := []byte("proposal response payload")
+	valid, invalid := true, false
+	tests := []struct {
+		name      string
+		signer    *testSigner
+		msg       []byte
+		roots     map[string]*MSPRoots
+		at        time.Time
+		signature bool
+		chain     *bool
+		errs      string
+	}{
+		{"valid signature", user, msg, roots, testTxTime, true, &valid, ""},
+		{"chain not checked", user, msg, nil, testTxTime, true, nil, ""},
+		{"tampered payload", user, []byte("tampered payload"), roots, testTxTime, false, &valid, "verification failure"},
+		{"leaf from the wrong ca", forged, msg, roots, testTxTime, true, &invalid, "unknown authority"},
+		{"unknown msp", stranger, msg, roots, testTxTime, true, &invalid, "msp Org3MSP is not a member of the channel"},
+		{"expired at the block time", user, msg, roots, testTxTime.Add(2 * time.Hour), true, &invalid, "expired"},
+	}
+
+	for _, test := range tests {
+		check := verifySignature(test.signer.identity, test.msg, test.signer.sign(t, msg), test.roots, test.at)
+		if check.Error != "" {
+			t.Fatalf("%s: %s", test.name, check.Error)
+		}
+		if check.MSP != "Org1MSP" && check.MSP != "Org3MSP" || !strings.HasPrefix(check.Name, "User1@") {
+			t.Errorf("%s: unexpected identity %s %s", test.name, check.MSP, check.Name)
+		}
+		if check.SignatureValid != test.signature {
+			t.Errorf("%s: expected signature valid %v, got %v", test.name, test.signature, check.SignatureValid)
+		}
+		if (check.ChainValid == nil) != (test.chain == nil) || check.ChainValid != nil && *check.ChainValid != *test.chain {
+			t.Errorf("%s: expected chain valid %v, got %v", test.name, test.chain, check.ChainValid)
+		}
+		if check.valid() != (test.signature && (test.chain == nil || *test.chain)) {
+			t.Errorf("%s: unexpected valid %v", test.name, check.valid())
+		}
+		if errs := check.SignatureError + check.ChainError; !strings.Contains(errs, test.errs) || test.errs == "" && errs != "" {
+			t.Errorf("%s: expected error %q, got %q", test.name, test.errs, errs)
+		}
+	}
+
+	// 无法解析的身份
+	if check := verifySignature([]byte{0xff}, msg, nil, roots, testTxTime); check.Error == "" || check.valid() {
+		t.Errorf("expected an undecodable identity to be reported, got %+v", check)
+	}
+}
+
+func TestVerifyEnvelope(t *testing.T) {
+	org1CA, org2CA := newTestCA(t, "Org1MSP"), newTestCA(t, "Org2MSP")
+	roots := testMSPRoots(t, []*testCA{org1CA, org2CA}, nil)
+	creator := org1CA.issue(t, "User1@org1.example.com")
+	peer0Org1 := org1CA.issue(t, "peer0.org1.example.com")
+	peer0Org2 := org2CA.issue(t, "peer0.org2.example.com")
+	forged := newTestCA(t, "Org2MSP").issue(t, "peer0.org2.example.com")
+	stranger := newTestCA(t, "Org3MSP").issue(t, "peer0.org3.example.com")
+
+	prp := []byte("proposal response payload")
+	endorse := func(signer *testSigner) *peer.Endorsement {
+		msg := append(append([]byte{}, prp...), signer.identity...)
+		return &peer.Endorsement{Endorser: signer.identity, Signature: signer.sign(t, msg)}
+	}
+	action := func(endorsements ...*peer.Endorsement) *parsedAction {
+		return &parsedAction{actionPayload: &peer.ChaincodeActionPayload{
+			Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: prp, Endorsements: endorsements},
+		}}
+	}
+	payload := []byte("transaction payload")
+	signature := creator.sign(t, payload)
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		actions   []*parsedAction
+		valid     bool
+		creator   bool
+		endorsers []bool
+	}{
+		{"valid", payload, []*parsedAction{action(endorse(peer0Org1), endorse(peer0Org2))}, true, true, []bool{true, true}},
+		{"tampered payload", []byte("tampered payload"), []*parsedAction{action(endorse(peer0Org1))}, false, false, []bool{true}},
+		{"endorser from the wrong ca", payload, []*parsedAction{action(endorse(peer0Org1)), action(endorse(forged))}, false, true, []bool{true, false}},
+		{"unknown msp", payload, []*parsedAction{action(endorse(stranger), endorse(peer0Org2))}, false, true, []bool{false, true}},
+		{"endorsement of another payload", payload, []*parsedAction{action(&peer.Endorsement{
+			Endorser: peer0Org1.identity, Signature: peer0Org1.sign(t, []byte("other payload")),
+		})}, false, true, []bool{false}},
+	}
+
+	for _, test := range tests {
+		env := &common.Envelope{Payload: test.payload, Signature: signature}
+		verification := verifyEnvelope(env, creator.identity, test.actions, roots, testTxTime)
+		if verification.Valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, verification.Valid)
+		}
+		if verification.Creator.valid() != test.creator {
+			t.Errorf("%s: expected creator valid %v, got %+v", test.name, test.creator, verification.Creator)
+		}
+		if len(verification.Endorsements) != len(test.endorsers) {
+			t.Fatalf("%s: expected %d endorsements, got %d", test.name, len(test.endorsers), len(verification.Endorsements))
+		}
+		for i, check := range verification.Endorsements {
+			if check.valid() != test.endorsers[i] {
+				t.Errorf("%s: expected endorsement %d valid %v, got %+v", test.name, i, test.endorsers[i], check)
+			}
+		}
+	}
+
+	// 每个背书结果记录其所属的action
+	verification := verifyEnvelope(&common.Envelope{Payload: payload, Signature: signature}, creator.identity,
+		[]*parsedAction{action(endorse(peer0Org1)), action(endorse(peer0Org2))}, roots, testTxTime)
+	if verification.Endorsements[0].Action != 0 || verification.Endorsements[1].Action != 1 || verification.Endorsements[1].MSP != "Org2MSP" {
+		t.Errorf("unexpected endorsements %+v %+v", verification.Endorsements[0], verification.Endorsements[1])
+	}
+}
@@ -0,0 +1,823 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// types of Subscription
+const (
+	SubscriptionTypeChaincode = "chaincode"
+	SubscriptionTypeCommit    = "commit"
+)
+
+// headers of the webhook request, the signature is "sha256=" followed by the hex HMAC-SHA256 of the body
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+// Checkpoint is the last delivered position of a subscription
+// TxID and Index are the last delivered payload of a partly delivered block, TxID is empty once every transaction of the block is delivered
+type Checkpoint struct {
+	Block uint64 `json:"block"`
+	TxID  string `json:"txID,omitempty"`
+	Index int    `json:"index,omitempty"`
+}
+
+// DeadLetter is a delivery given up after all attempts
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failedAt"`
+}
+
+// Subscription is a webhook called for matching chaincode events or transaction commits
+// Checkpoint is nil until the first block is delivered when subscribed from the genesis block
+// Error is the last error of the delivery worker, the worker restarts after MaxBackoff
+type Subscription struct {
+	ID              string         `json:"id"`
+	ChannelID       string         `json:"channelID"`
+	ChaincodeID     string         `json:"chaincodeID"`
+	Type            string         `json:"type"`
+	Event           string         `json:"event,omitempty"`
+	URL             string         `json:"url"`
+	Secret          string         `json:"secret,omitempty"`
+	User            string         `json:"user"`
+	Identity        FabricIdentity `json:"identity"`
+	Checkpoint      *Checkpoint    `json:"checkpoint,omitempty"`
+	DeadLetters     []*DeadLetter  `json:"deadLetters,omitempty"`
+	DeadLetterCount int            `json:"deadLetterCount"`
+	Error           string         `json:"error,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt"`
+}
+
+// view 返回不含secret及死信内容的副本，用于响应
+func (sub *Subscription) view() *Subscription {
+	copied := sub.copy()
+	copied.Secret = ""
+	return copied
+}
+
+// copy 返回不含死信的副本，保留secret用于投递签名
+func (sub *Subscription) copy() *Subscription {
+	copied := *sub
+	copied.DeadLetters = nil
+	copied.DeadLetterCount = len(sub.DeadLetters)
+	if sub.Checkpoint != nil {
+		checkpoint := *sub.Checkpoint
+		copied.Checkpoint = &checkpoint
+	}
+	return &copied
+}
+
+// WebhookPayload is the body posted to the subscription url
+// Event is set for chaincode subscriptions, ValidationResult for commit subscriptions
+type WebhookPayload struct {
+	SubscriptionID   string    `json:"subscriptionID"`
+	Type             string    `json:"type"`
+	ChannelID        string    `json:"channelID"`
+	ChaincodeID      string    `json:"chaincodeID"`
+	BlockNumber      uint64    `json:"blockNumber"`
+	TxID             string    `json:"txID"`
+	ValidationResult string    `json:"validationResult,omitempty"`
+	Event            *CCEvent  `json:"event,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// checkpointInterval 投递过程中只更新内存中的checkpoint，至多间隔checkpointInterval持久化一次
+const checkpointInterval = 5 * time.Second
+
+// errDeliveryAborted 订阅删除或服务退出时结束投递
+var errDeliveryAborted = errors.New("webhook delivery aborted")
+
+// subscriptionManager 保存订阅并为每个订阅运行一个投递worker，订阅、checkpoint及死信持久化到storePath
+// dirty表示内存中有尚未持久化的checkpoint，savedAt为上次持久化的时间
+type subscriptionManager struct {
+	mutex   sync.Mutex
+	subs    map[string]*Subscription
+	cancels map[string]context.CancelFunc
+	workers sync.WaitGroup
+	client  *http.Client
+	targets *webhookTargets
+	dirty   bool
+	savedAt time.Time
+
+	storePath       string
+	maxAttempts     int
+	initialBackoff  time.Duration
+	maxBackoff      time.Duration
+	deadLetterLimit int
+}
+
+var subscriptions *subscriptionManager
+
+func newSubscriptionManager(config *WebhookConfig) (*subscriptionManager, error) {
+	m := &subscriptionManager{
+		subs:            make(map[string]*Subscription),
+		cancels:         make(map[string]context.CancelFunc),
+		storePath:       config.StorePath,
+		maxAttempts:     config.MaxAttempts,
+		deadLetterLimit: config.DeadLetterLimit,
+	}
+	if m.storePath == "" {
+		m.storePath = "./data/subscriptions.json"
+	}
+	if m.maxAttempts <= 0 {
+		m.maxAttempts = 5
+	}
+	if m.deadLetterLimit <= 0 {
+		m.deadLetterLimit = 100
+	}
+
+	var err error
+	if m.initialBackoff, err = durationOrDefault(config.InitialBackoff, time.Second); err != nil {
+		return nil, fmt.Errorf("invalid webhook initialBackoff: %v", err)
+	}
+	if m.maxBackoff, err = durationOrDefault(config.MaxBackoff, time.Minute); err != nil {
+		return nil, fmt.Errorf("invalid webhook maxBackoff: %v", err)
+	}
+	timeout, err := durationOrDefault(config.Timeout, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook timeout: %v", err)
+	}
+	if m.targets, err = newWebhookTargets(config); err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: timeout, Control: m.targets.control}
+	m.client = &http.Client{
+		Timeout: timeout,
+		// 不使用代理，连接的地址即webhook解析后的地址
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// 重定向的地址未经allowHosts检查，不跟随重定向
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	buf, err := ioutil.ReadFile(m.storePath)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read subscriptions failed: %v", err)
+	}
+	subs := make([]*Subscription, 0)
+	if err := json.Unmarshal(buf, &subs); err != nil {
+		return nil, fmt.Errorf("invalid subscriptions file %s: %v", m.storePath, err)
+	}
+	for _, sub := range subs {
+		m.subs[sub.ID] = sub
+	}
+	return m, nil
+}
+
+// save 持久化所有订阅，调用方需持有mutex
+// 先写临时文件再重命名，避免进程退出时留下不完整的文件
+func (m *subscriptionManager) save() error {
+	subs := make([]*Subscription, 0, len(m.subs))
+	for _, sub := range m.subs {
+		subs = append(subs, sub)
+	}
+	buf, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.storePath), 0700); err != nil {
+		return err
+	}
+	tmp := m.storePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.storePath); err != nil {
+		return err
+	}
+	m.dirty = false
+	m.savedAt = time.Now()
+	return nil
+}
+
+// start 为已加载的订阅启动投递worker
+func (m *subscriptionManager) start() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, sub := range m.subs {
+		m.startWorker(sub)
+	}
+}
+
+// startWorker 调用方需持有mutex
+func (m *subscriptionManager) startWorker(sub *Subscription) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancels[sub.ID] = cancel
+	m.workers.Add(1)
+	go m.run(ctx, sub.ID)
+}
+
+func (m *subscriptionManager) add(sub *Subscription) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.subs[sub.ID] = sub
+	if err := m.save(); err != nil {
+		delete(m.subs, sub.ID)
+		return err
+	}
+	m.startWorker(sub)
+	return nil
+}
+
+func (m *subscriptionManager) remove(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if cancel, ok := m.cancels[id]; ok {
+		cancel()
+		delete(m.cancels, id)
+	}
+	delete(m.subs, id)
+	return m.save()
+}
+
+// get 返回订阅的副本，withDeadLetters为true时包含死信
+func (m *subscriptionManager) get(id string, withDeadLetters bool) (*Subscription, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sub, ok := m.subs[id]
+	if !ok {
+		return nil, false
+	}
+	view := sub.view()
+	if withDeadLetters {
+		view.DeadLetters = append([]*DeadLetter{}, sub.DeadLetters...)
+	}
+	return view, true
+}
+
+// subscription 返回包含secret的订阅副本，仅供投递worker使用，不可返回给调用方
+func (m *subscriptionManager) subscription(id string) (*Subscription, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sub, ok := m.subs[id]
+	if !ok {
+		return nil, false
+	}
+	return sub.copy(), true
+}
+
+func (m *subscriptionManager) list(user string) []*Subscription {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	subs := make([]*Subscription, 0)
+	for _, sub := range m.subs {
+		if sub.User == user {
+			subs = append(subs, sub.view())
+		}
+	}
+	return subs
+}
+
+// update 修改订阅并持久化，订阅已删除时返回false
+func (m *subscriptionManager) update(id string, update func(*Subscription)) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sub, ok := m.subs[id]
+	if !ok {
+		return false
+	}
+	update(sub)
+	if err := m.save(); err != nil {
+		log.Println("the save subscriptions err info is : ", err.Error())
+	}
+	return true
+}
+
+// updateCheckpoint 修改内存中的checkpoint，订阅已删除时返回false
+// flush为true或距上次持久化超过checkpointInterval时写入文件，否则由之后的写入或flush一并持久化
+func (m *subscriptionManager) updateCheckpoint(id string, checkpoint *Checkpoint, flush bool) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sub, ok := m.subs[id]
+	if !ok {
+		return false
+	}
+	sub.Checkpoint = checkpoint
+	sub.Error = ""
+	m.dirty = true
+	if flush || time.Since(m.savedAt) >= checkpointInterval {
+		if err := m.save(); err != nil {
+			log.Println("the save subscriptions err info is : ", err.Error())
+		}
+	}
+	return true
+}
+
+// flush 持久化尚未写入文件的checkpoint
+func (m *subscriptionManager) flush() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.dirty {
+		return
+	}
+	if err := m.save(); err != nil {
+		log.Println("the save subscriptions err info is : ", err.Error())
+	}
+}
+
+func (m *subscriptionManager) wait(ctx context.Context) error {
+	return waitWithContext(ctx, &m.workers)
+}
+
+// sleep 等待d，订阅删除或服务退出时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-streamsClosing:
+		return false
+	}
+}
+
+// run 投递worker，出错后间隔maxBackoff从checkpoint重新开始
+func (m *subscriptionManager) run(ctx context.Context, id string) {
+	defer m.workers.Done()
+
+	for {
+		// get返回的副本不含secret，无法签名
+		sub, ok := m.subscription(id)
+		if !ok {
+			return
+		}
+		err := m.deliverFrom(ctx, sub)
+		if err == nil {
+			return
+		}
+		log.Println("the webhook worker err info is : ", id, "====", err.Error())
+		if !m.update(id, func(sub *Subscription) { sub.Error = err.Error() }) {
+			return
+		}
+		if !sleep(ctx, m.maxBackoff) {
+			return
+		}
+	}
+}
+
+// deliverFrom 从checkpoint之后开始投递，订阅删除或服务退出时返回nil
+// 每次投递后更新内存中的checkpoint，区块中有投递时在区块结束后持久化，返回前持久化尚未写入的checkpoint
+func (m *subscriptionManager) deliverFrom(ctx context.Context, sub *Subscription) error {
+	defer m.flush()
+
+	eventFilter, err := compileEventFilter(sub.Event)
+	if err != nil {
+		return err
+	}
+	var peer string
+	if len(serverConfig.TargetPeers) > 0 {
+		peer = serverConfig.TargetPeers[0]
+	}
+	stream, err := openBlockStream(sub.ChannelID, peer, &sub.Identity, true)
+	if err != nil {
+		return err
+	}
+
+	var token *resumeToken
+	if sub.Checkpoint != nil {
+		token = &resumeToken{block: sub.Checkpoint.Block, txID: sub.Checkpoint.TxID, index: sub.Checkpoint.Index}
+		stream.next = token.block
+		if token.txID == "" {
+			stream.next++
+		}
+	}
+
+	err = stream.run(ctx, &streamHandlers{block: func(block *cb.Block) error {
+		detail, err := convertBlockToDetail(sub.ChannelID, block, &TxDetailOptions{})
+		if err != nil {
+			return err
+		}
+		delivered := false
+		for _, tx := range pendingTransactions(detail, token) {
+			for i, payload := range webhookPayloads(sub, eventFilter, detail.Number, tx) {
+				if token.delivered(detail.Number, tx.ID, i) {
+					continue
+				}
+				if !m.deliver(ctx, sub, eventID(detail.Number, tx.ID, i), payload) {
+					return errDeliveryAborted
+				}
+				delivered = true
+				if !m.updateCheckpoint(sub.ID, &Checkpoint{Block: detail.Number, TxID: tx.ID, Index: i}, false) {
+					return errDeliveryAborted
+				}
+			}
+		}
+		if !m.updateCheckpoint(sub.ID, &Checkpoint{Block: detail.Number}, delivered) {
+			return errDeliveryAborted
+		}
+		return nil
+	}})
+	if err == errDeliveryAborted {
+		return nil
+	}
+	return err
+}
+
+// webhookPayloads 返回交易中需要投递的内容，序号与streamChaincodeEvents的事件id一致
+func webhookPayloads(sub *Subscription, eventFilter *regexp.Regexp, blockNumber uint64, tx *TransactionDetail) []*WebhookPayload {
+	payloads := make([]*WebhookPayload, 0)
+	newPayload := func() *WebhookPayload {
+		return &WebhookPayload{
+			SubscriptionID: sub.ID,
+			Type:           sub.Type,
+			ChannelID:      sub.ChannelID,
+			ChaincodeID:    sub.ChaincodeID,
+			BlockNumber:    blockNumber,
+			TxID:           tx.ID,
+			Timestamp:      time.Now(),
+		}
+	}
+
+	switch sub.Type {
+	case SubscriptionTypeCommit:
+		// 包括校验失败的交易，由ValidationResult区分
+		if tx.ChaincodeName != sub.ChaincodeID {
+			return payloads
+		}
+		payload := newPayload()
+		payload.ValidationResult = tx.ValidationResult
+		payloads = append(payloads, payload)
+	default:
+		for _, ccEvent := range chaincodeEvents(tx, sub.ChaincodeID, eventFilter) {
+			payload := newPayload()
+			payload.Event = ccEvent
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads
+}
+
+// deliver 按指数退避重试投递，全部失败后记入死信
+// 订阅删除或服务退出时返回false，此时未更新checkpoint，重启后会重新投递
+// deliveryID 为 区块号:txID:序号，接收方可据此去重
+func (m *subscriptionManager) deliver(ctx context.Context, sub *Subscription, deliveryID string, payload *WebhookPayload) bool {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("the webhook payload err info is : ", err.Error())
+		return true
+	}
+
+	backoff := m.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err = m.post(ctx, sub, deliveryID, body)
+		if err == nil {
+			return true
+		}
+		log.Println("the webhook delivery err info is : ", sub.ID, "====", deliveryID, "===", attempt, err.Error())
+		if attempt >= m.maxAttempts {
+			break
+		}
+		if !sleep(ctx, backoff) {
+			return false
+		}
+		if backoff *= 2; backoff > m.maxBackoff {
+			backoff = m.maxBackoff
+		}
+	}
+
+	return m.update(sub.ID, func(s *Subscription) {
+		s.DeadLetters = append(s.DeadLetters, &DeadLetter{
+			ID:       deliveryID,
+			Payload:  body,
+			Attempts: m.maxAttempts,
+			Error:    err.Error(),
+			FailedAt: time.Now(),
+		})
+		if len(s.DeadLetters) > m.deadLetterLimit {
+			s.DeadLetters = s.DeadLetters[len(s.DeadLetters)-m.deadLetterLimit:]
+		}
+	})
+}
+
+// post 投递前按当前配置重新检查url，订阅可能在修改allowHosts之前创建
+func (m *subscriptionManager) post(ctx context.Context, sub *Subscription, deliveryID string, body []byte) error {
+	if err := m.targets.checkURL(sub.URL); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	mac := hmac.New(sha256.New, []byte(sub.Secret))
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, deliveryID)
+	req.Header.Set(HeaderWebhookEvent, sub.Type)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// defaultDenyNetworks webhook默认不能访问的网络，包括本机、内网及云主机元数据地址
+var defaultDenyNetworks = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10",
+}
+
+// webhookTargets 限制webhook可以访问的地址，防止通过订阅访问内网(SSRF)
+type webhookTargets struct {
+	allowHosts   []string
+	denyNetworks []*net.IPNet
+}
+
+func newWebhookTargets(config *WebhookConfig) (*webhookTargets, error) {
+	targets := &webhookTargets{}
+	for _, host := range config.AllowHosts {
+		targets.allowHosts = append(targets.allowHosts, strings.ToLower(host))
+	}
+	networks := config.DenyNetworks
+	if len(networks) == 0 {
+		networks = defaultDenyNetworks
+	}
+	for _, cidr := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook denyNetworks %s: %v", cidr, err)
+		}
+		targets.denyNetworks = append(targets.denyNetworks, network)
+	}
+	return targets, nil
+}
+
+// checkURL 检查url的主机，ip地址在此检查，域名解析后的地址在连接时由control检查
+func (t *webhookTargets) checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+	host := strings.ToLower(u.Hostname())
+	if !t.allowed(host) {
+		return fmt.Errorf("webhook host %s is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return t.checkIP(ip)
+	}
+	return nil
+}
+
+// allowed allowHosts为空时允许所有主机，"*.example.com"匹配example.com的子域名
+func (t *webhookTargets) allowed(host string) bool {
+	if len(t.allowHosts) == 0 {
+		return true
+	}
+	for _, allow := range t.allowHosts {
+		if host == allow || (strings.HasPrefix(allow, "*.") && strings.HasSuffix(host, allow[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *webhookTargets) checkIP(ip net.IP) error {
+	for _, network := range t.denyNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("webhook address %s is denied", ip)
+		}
+	}
+	return nil
+}
+
+// control 在建立连接前检查解析后的地址，避免创建订阅后通过修改DNS访问内网
+func (t *webhookTargets) control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid webhook address %s", address)
+	}
+	return t.checkIP(ip)
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// initialCheckpoint 根据from计算初始checkpoint，从创世区块开始时为nil
+func initialCheckpoint(req *SubscriptionRequest, identity *FabricIdentity) (*Checkpoint, error) {
+	if req.From == "oldest" {
+		return nil, nil
+	}
+
+	channelContext := sdk.ChannelContext(req.ChannelID, fabsdk.WithUser(identity.UserName), fabsdk.WithOrg(identity.OrgName))
+	ledgerClient, err := ledger.New(channelContext)
+	if err != nil {
+		return nil, err
+	}
+	var peer string
+	if len(serverConfig.TargetPeers) > 0 {
+		peer = serverConfig.TargetPeers[0]
+	}
+	info, err := ledgerClient.QueryInfo(ledger.WithTargetEndpoints(peer))
+	if err != nil {
+		return nil, err
+	}
+	height := info.BCI.Height
+
+	from := height
+	if req.From != "" && req.From != "newest" {
+		if from, err = strconv.ParseUint(req.From, 10, 64); err != nil {
+			return nil, errors.New("from must be a block number, oldest or newest")
+		}
+		if from > height {
+			return nil, fmt.Errorf("block %d is beyond the ledger height %d", from, height)
+		}
+	}
+	if from == 0 {
+		return nil, nil
+	}
+	return &Checkpoint{Block: from - 1}, nil
+}
+
+// createSubscription 处理 POST /subscriptions
+func createSubscription(ctx *gin.Context) {
+	req := new(SubscriptionRequest)
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: req.ChannelID, ChaincodeID: req.ChaincodeID}) {
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = SubscriptionTypeChaincode
+	}
+	if req.Type != SubscriptionTypeChaincode && req.Type != SubscriptionTypeCommit {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "type must be chaincode or commit"})
+		return
+	}
+	if err := subscriptions.targets.checkURL(req.URL); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := compileEventFilter(req.Event); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid event: " + err.Error()})
+		return
+	}
+
+	identity, err := resolveIdentity(ctx, req.OrgName, req.UserName)
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	checkpoint, err := initialCheckpoint(req, identity)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	sub := &Subscription{
+		ID:          id,
+		ChannelID:   req.ChannelID,
+		ChaincodeID: req.ChaincodeID,
+		Type:        req.Type,
+		Event:       req.Event,
+		URL:         req.URL,
+		Secret:      secret,
+		User:        ctx.GetString(gin.AuthUserKey),
+		Identity:    *identity,
+		Checkpoint:  checkpoint,
+		CreatedAt:   time.Now(),
+	}
+	if err := subscriptions.add(sub); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Println("the response is : subscribed ", sub.ID, "====", sub.URL)
+	response := sub.view()
+	// secret只在创建时返回一次
+	response.Secret = secret
+	ctx.JSON(http.StatusCreated, gin.H{"status": http.StatusCreated, "response": response})
+}
+
+// ownSubscription 查询当前rest用户的订阅，不存在或不属于该用户时已写入404响应
+func ownSubscription(ctx *gin.Context, withDeadLetters bool) (*Subscription, bool) {
+	sub, ok := subscriptions.get(ctx.Param("id"), withDeadLetters)
+	if !ok || sub.User != ctx.GetString(gin.AuthUserKey) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "subscription not found"})
+		return nil, false
+	}
+	if !authorize(ctx, &ACLResource{ChannelID: sub.ChannelID, ChaincodeID: sub.ChaincodeID}) {
+		return nil, false
+	}
+	return sub, true
+}
+
+// listSubscriptions 处理 GET /subscriptions，返回当前rest用户的订阅
+func listSubscriptions(ctx *gin.Context) {
+	if !authorize(ctx, &ACLResource{}) {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": subscriptions.list(ctx.GetString(gin.AuthUserKey))})
+}
+
+func getSubscription(ctx *gin.Context) {
+	sub, ok := ownSubscription(ctx, false)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": sub})
+}
+
+func deleteSubscription(ctx *gin.Context) {
+	sub, ok := ownSubscription(ctx, false)
+	if !ok {
+		return
+	}
+	if err := subscriptions.remove(sub.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Println("the response is : unsubscribed ", sub.ID)
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": sub.ID})
+}
+
+// listDeadLetters 处理 GET /subscriptions/:id/dead-letters
+func listDeadLetters(ctx *gin.Context) {
+	sub, ok := ownSubscription(ctx, true)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "response": sub.DeadLetters})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWebhookTargets(t *testing.T) {
+	tests := []struct {
+		config WebhookConfig
+		url    string
+		ok     bool
+	}{
+		{WebhookConfig{}, "https://hooks.example.com/fabric", true},
+		{WebhookConfig{}, "ftp://hooks.example.com/fabric", false},
+		{WebhookConfig{}, "/fabric", false},
+		// 默认拒绝本机、内网及元数据地址
+		{WebhookConfig{}, "http://127.0.0.1:8080/", false},
+		{WebhookConfig{}, "http://10.1.2.3/", false},
+		{WebhookConfig{}, "http://169.254.169.254/latest/meta-data", false},
+		{WebhookConfig{}, "http://[::1]/", false},
+		{WebhookConfig{}, "http://[::ffff:127.0.0.1]/", false},
+		{WebhookConfig{}, "http://8.8.8.8/", true},
+		{WebhookConfig{DenyNetworks: []string{"169.254.0.0/16"}}, "http://127.0.0.1:8080/", true},
+		{WebhookConfig{DenyNetworks: []string{"169.254.0.0/16"}}, "http://169.254.169.254/", false},
+		{WebhookConfig{AllowHosts: []string{"hooks.example.com", "*.example.org"}}, "https://HOOKS.example.com/", true},
+		{WebhookConfig{AllowHosts: []string{"hooks.example.com", "*.example.org"}}, "https://a.b.example.org/", true},
+		{WebhookConfig{AllowHosts: []string{"hooks.example.com", "*.example.org"}}, "https://example.org/", false},
+		{WebhookConfig{AllowHosts: []string{"hooks.example.com", "*.example.org"}}, "https://evil-example.org/", false},
+		{WebhookConfig{AllowHosts: []string{"hooks.example.com"}}, "https://other.example.com/", false},
+		// 允许的主机仍然受denyNetworks限制
+		{WebhookConfig{AllowHosts: []string{"127.0.0.1"}}, "http://127.0.0.1/", false},
+	}
+
+	for _, test := range tests {
+		targets, err := newWebhookTargets(&test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := targets.checkURL(test.url); (err == nil) != test.ok {
+			t.Errorf("%s %+v: expected ok %v, got %v", test.url, test.config, test.ok, err)
+		}
+	}
+
+	if _, err := newWebhookTargets(&WebhookConfig{DenyNetworks: []string{"10.0.0.0"}}); err == nil {
+		t.Error("expected an invalid cidr to be rejected")
+	}
+}
+
+// newTestSubscriptionManager 创建使用临时文件保存订阅的manager
+func newTestSubscriptionManager(t *testing.T, config *WebhookConfig) (*subscriptionManager, func()) {
+	dir, err := ioutil.TempDir("", "webhook-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.StorePath = filepath.Join(dir, "subscriptions.json")
+	m, err := newSubscriptionManager(config)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return m, func() { os.RemoveAll(dir) }
+}
+
+func TestWebhookPost(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	m, cleanup := newTestSubscriptionManager(t, &WebhookConfig{DenyNetworks: []string{"169.254.0.0/16"}})
+	defer cleanup()
+	sub := &Subscription{ID: "sub1", Type: SubscriptionTypeChaincode, URL: server.URL + "/hook", Secret: "webhook-secret"}
+	payload, _ := json.Marshal(&WebhookPayload{SubscriptionID: sub.ID, BlockNumber: 5, TxID: "tx1"})
+	if err := m.post(context.Background(), sub, "5:tx1:1", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != string(payload) {
+		t.Errorf("expected body %s, got %s", payload, body)
+	}
+	if id := received.Header.Get(HeaderWebhookID); id != "5:tx1:1" {
+		t.Errorf("expected delivery id 5:tx1:1, got %s", id)
+	}
+	if event := received.Header.Get(HeaderWebhookEvent); event != SubscriptionTypeChaincode {
+		t.Errorf("expected event %s, got %s", SubscriptionTypeChaincode, event)
+	}
+	// 接收方使用secret计算body的HMAC-SHA256校验签名
+	mac := hmac.New(sha256.New, []byte(sub.Secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	signature := received.Header.Get(HeaderWebhookSignature)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		t.Errorf("expected signature %s, got %s", expected, signature)
+	}
+	sub.Secret = "other-secret"
+	if err := m.post(context.Background(), sub, "5:tx1:1", payload); err != nil {
+		t.Fatal(err)
+	}
+	if received.Header.Get(HeaderWebhookSignature) == expected {
+		t.Error("expected the signature to depend on the secret")
+	}
+
+	// 默认配置在连接时拒绝解析到本机的域名
+	denied, cleanupDenied := newTestSubscriptionManager(t, &WebhookConfig{})
+	defer cleanupDenied()
+	received = nil
+	sub.URL = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	if err := denied.post(context.Background(), sub, "5:tx1:1", payload); err == nil || received != nil {
+		t.Errorf("expected the delivery to localhost to be denied, got %v", err)
+	}
+}
+
+func TestUpdateCheckpoint(t *testing.T) {
+	m, cleanup := newTestSubscriptionManager(t, &WebhookConfig{})
+	defer cleanup()
+	// 不使用add，避免启动投递worker
+	m.subs["sub1"] = &Subscription{ID: "sub1", URL: "https://hooks.example.com/"}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := func() *Checkpoint {
+		buf, err := ioutil.ReadFile(m.storePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var subs []*Subscription
+		if err := json.Unmarshal(buf, &subs); err != nil {
+			t.Fatal(err)
+		}
+		return subs[0].Checkpoint
+	}
+
+	// 刚持久化过，只更新内存
+	m.updateCheckpoint("sub1", &Checkpoint{Block: 3, TxID: "tx1", Index: 1}, false)
+	if checkpoint := stored(); checkpoint != nil {
+		t.Errorf("expected the checkpoint to be saved later, got %+v", checkpoint)
+	}
+	if sub, _ := m.get("sub1", false); *sub.Checkpoint != (Checkpoint{Block: 3, TxID: "tx1", Index: 1}) {
+		t.Errorf("unexpected checkpoint in memory %+v", sub.Checkpoint)
+	}
+	m.flush()
+	if checkpoint := stored(); checkpoint == nil || *checkpoint != (Checkpoint{Block: 3, TxID: "tx1", Index: 1}) {
+		t.Errorf("expected the checkpoint to be flushed, got %+v", checkpoint)
+	}
+	m.updateCheckpoint("sub1", &Checkpoint{Block: 3}, true)
+	if checkpoint := stored(); checkpoint == nil || *checkpoint != (Checkpoint{Block: 3}) {
+		t.Errorf("expected the checkpoint to be saved, got %+v", checkpoint)
+	}
+	if m.updateCheckpoint("sub2", &Checkpoint{Block: 3}, true) {
+		t.Error("expected the checkpoint of an unknown subscription to be rejected")
+	}
+}
+
+func TestWebhookDeliverySecret(t *testing.T) {
+	const secret = "registered-secret"
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		signature := r.Header.Get(HeaderWebhookSignature)
+		signatures = append(signatures, signature)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	config := &WebhookConfig{DenyNetworks: []string{"169.254.0.0/16"}, MaxAttempts: 1}
+	m, cleanup := newTestSubscriptionManager(t, config)
+	defer cleanup()
+	// 不使用add，避免启动投递worker
+	m.subs["sub1"] = &Subscription{ID: "sub1", Type: SubscriptionTypeChaincode, URL: server.URL + "/hook", Secret: secret}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+	// 重启后从文件加载的订阅同样保留secret
+	reloaded, err := newSubscriptionManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, manager := range []*subscriptionManager{m, reloaded} {
+		if view, _ := manager.get("sub1", false); view.Secret != "" {
+			t.Error("expected get to hide the secret")
+		}
+		// 与worker相同，通过subscription取得订阅后投递
+		sub, ok := manager.subscription("sub1")
+		if !ok {
+			t.Fatal("subscription not found")
+		}
+		if !manager.deliver(context.Background(), sub, "5:tx1:0", &WebhookPayload{SubscriptionID: "sub1", BlockNumber: 5, TxID: "tx1"}) {
+			t.Fatal("expected the delivery to finish")
+		}
+		if view, _ := manager.get("sub1", true); len(view.DeadLetters) != 0 {
+			t.Errorf("expected the receiver to accept the signature, got dead letters %+v", view.DeadLetters[0])
+		}
+	}
+	if len(signatures) != 2 {
+		t.Errorf("expected 2 deliveries, got %d", len(signatures))
+	}
+}